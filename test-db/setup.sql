@@ -9,11 +9,44 @@ CREATE TABLE urls (
     createdAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     clicks INT DEFAULT 0,
     lastClicked TIMESTAMP NULL DEFAULT NULL,
+    expiresAt TIMESTAMP NULL DEFAULT NULL,
+    disabled BOOLEAN NOT NULL DEFAULT FALSE,
+    deletedAt TIMESTAMP NULL DEFAULT NULL,
     INDEX idx_shortUrl (shortUrl),
-    INDEX idx_longUrl_hash (longUrl(255))
+    INDEX idx_longUrl_hash (longUrl(255)),
+    INDEX idx_clicks (clicks, lastClicked)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
 
 -- Add some test data
 INSERT INTO urls (shortUrl, longUrl) VALUES
 ('test123', 'https://www.example.com'),
 ('demo456', 'https://www.google.com');
+
+-- One row per snowflake machine ID (10 bits), claimed by instances running with WORKER_LEASE_SECONDS set
+DROP TABLE IF EXISTS worker_leases;
+
+CREATE TABLE worker_leases (
+    workerId SMALLINT PRIMARY KEY,
+    leaseOwner VARCHAR(255) NULL DEFAULT NULL,
+    expiresAt TIMESTAMP(3) NULL DEFAULT NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+SET SESSION cte_max_recursion_depth = 1024;
+
+INSERT INTO worker_leases (workerId)
+WITH RECURSIVE ids (n) AS (
+    SELECT 0
+    UNION ALL
+    SELECT n + 1 FROM ids WHERE n < 1023
+)
+SELECT n FROM ids;
+
+-- Ticket counters for ID_GENERATOR=ticket, nextId is the first ticket not yet leased
+DROP TABLE IF EXISTS tickets;
+
+CREATE TABLE tickets (
+    name VARCHAR(32) PRIMARY KEY,
+    nextId BIGINT NOT NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+INSERT INTO tickets (name, nextId) VALUES ('shortCode', 1);
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"crypto/subtle"
+	"expvar"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// CacheEntryResponse represents a cached entry as seen by the admin API
+// Missing marks a negative entry, cached because the short code doesn't exist
+type CacheEntryResponse struct {
+	ShortCode string    `json:"shortCode"`
+	LongURL   string    `json:"longUrl,omitempty"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	Missing   bool      `json:"missing"`
+}
+
+// authorizeAdmin checks the request carries the admin bearer token, responding with an error if not
+// the admin API, link management included, is disabled when no token is configured
+func (api *UrlShortenerAPI) authorizeAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if api.adminToken == "" {
+		api.respondWithError(w, http.StatusForbidden, "Admin API is disabled")
+		return false
+	}
+
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found || subtle.ConstantTimeCompare([]byte(token), []byte(api.adminToken)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		api.respondWithError(w, http.StatusUnauthorized, "Invalid admin token")
+		return false
+	}
+
+	return true
+}
+
+// CacheStatsHandler handles GET requests for the cache's hit, miss, expiration and eviction counters
+func (api *UrlShortenerAPI) CacheStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if !api.authorizeAdmin(w, r) {
+		return
+	}
+
+	api.respondWithJSON(w, http.StatusOK, api.cache.Stats())
+}
+
+// CacheEntryHandler handles GET requests for the cached entry of a single short code
+func (api *UrlShortenerAPI) CacheEntryHandler(w http.ResponseWriter, r *http.Request) {
+	if !api.authorizeAdmin(w, r) {
+		return
+	}
+
+	shortCode := mux.Vars(r)["shortCode"]
+	if shortCode == "" {
+		api.respondWithError(w, http.StatusBadRequest, "Short code required")
+		return
+	}
+
+	item, found := api.cache.Peek(shortCode)
+	if !found {
+		api.respondWithError(w, http.StatusNotFound, "Short code not cached")
+		return
+	}
+
+	api.respondWithJSON(w, http.StatusOK, CacheEntryResponse{
+		ShortCode: shortCode,
+		LongURL:   item.LongURL,
+		ExpiresAt: item.ExpiresAt,
+		Missing:   item.Missing,
+	})
+}
+
+// FlushCacheHandler handles DELETE requests that empty the cache
+func (api *UrlShortenerAPI) FlushCacheHandler(w http.ResponseWriter, r *http.Request) {
+	if !api.authorizeAdmin(w, r) {
+		return
+	}
+
+	api.cache.Flush()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// MetricsHandler handles GET requests for the process's expvar variables, such as the snowflake clock rollback counters
+func (api *UrlShortenerAPI) MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	if !api.authorizeAdmin(w, r) {
+		return
+	}
+
+	expvar.Handler().ServeHTTP(w, r)
+}
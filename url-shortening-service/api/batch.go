@@ -0,0 +1,190 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/oyinetare/url-shortener/repository"
+)
+
+// defaultMaxBatchSize caps a single batch request
+const defaultMaxBatchSize = 1000
+
+// BatchShortenResult represents the outcome of one item in a batch request
+// Error is set instead of ShortURL when the item failed
+type BatchShortenResult struct {
+	Index     int        `json:"index"`
+	ShortURL  string     `json:"shortUrl,omitempty"`
+	LongURL   string     `json:"longUrl"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// BatchShortenResponse represents the per-item results of a batch request, in request order
+type BatchShortenResponse struct {
+	Results []BatchShortenResult `json:"results"`
+}
+
+// batchItem tracks one valid item while its short code is being saved
+type batchItem struct {
+	index     int
+	longURL   string
+	alias     string
+	expiresAt *time.Time
+}
+
+// shortenBatch validates every item, generates codes in bulk and saves them in one transaction per attempt
+// Unlike shorten, batch items are not deduplicated against existing links
+func (api *UrlShortenerAPI) shortenBatch(ctx context.Context, reqs []ShortenRequest) ([]BatchShortenResult, error) {
+	results := make([]BatchShortenResult, len(reqs))
+	now := time.Now()
+
+	var pending []batchItem
+	for i, req := range reqs {
+		results[i] = BatchShortenResult{Index: i, LongURL: req.LongURL}
+
+		item, err := api.validateBatchItem(i, req, now)
+		if err != nil {
+			_, results[i].Error = api.shortenError(err)
+			continue
+		}
+		pending = append(pending, item)
+	}
+
+	// generated codes that collide are regenerated, taken aliases fail straight away
+	maxAttempts := 5
+	for attempt := 0; attempt < maxAttempts && len(pending) > 0; attempt++ {
+		urls, err := api.assignShortCodes(pending)
+		if err != nil {
+			return nil, err
+		}
+
+		itemErrs, err := api.repo.SaveUrlsBatch(ctx, urls)
+		if err != nil {
+			return nil, err
+		}
+
+		var retry []batchItem
+		for j, item := range pending {
+			switch {
+			case itemErrs[j] == nil:
+				api.cacheURL(urls[j].ShortURL, item.longURL, item.expiresAt)
+				resp := api.shortenResponse(urls[j].ShortURL, item.longURL, item.expiresAt)
+				results[item.index].ShortURL = resp.ShortURL
+				results[item.index].ExpiresAt = resp.ExpiresAt
+			case itemErrs[j] == repository.ErrDuplicateShortCode && item.alias == "":
+				retry = append(retry, item)
+			default:
+				_, results[item.index].Error = api.shortenError(itemErrs[j])
+			}
+		}
+		pending = retry
+	}
+
+	for _, item := range pending {
+		results[item.index].Error = fmt.Sprintf("Failed to create unique short code after %d attempts", maxAttempts)
+	}
+
+	return results, nil
+}
+
+// validateBatchItem applies the same checks as shorten to a single batch item
+func (api *UrlShortenerAPI) validateBatchItem(index int, req ShortenRequest, now time.Time) (batchItem, error) {
+	if err := validateLongURL(req.LongURL); err != nil {
+		return batchItem{}, err
+	}
+
+	expiresAt, err := api.resolveExpiry(req, now)
+	if err != nil {
+		return batchItem{}, err
+	}
+
+	if req.CustomAlias != "" {
+		if err := api.validateAlias(req.CustomAlias); err != nil {
+			return batchItem{}, err
+		}
+	}
+
+	return batchItem{
+		index:     index,
+		longURL:   req.LongURL,
+		alias:     req.CustomAlias,
+		expiresAt: expiresAt,
+	}, nil
+}
+
+// assignShortCodes builds the rows to insert, generating codes in bulk for items without an alias
+func (api *UrlShortenerAPI) assignShortCodes(items []batchItem) ([]repository.URLs, error) {
+	needed := 0
+	for _, item := range items {
+		if item.alias == "" {
+			needed++
+		}
+	}
+
+	codes, err := api.idgenerator.GenerateShortCodes(needed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate short codes: %w", err)
+	}
+
+	// swap out any generated code that collides with a reserved path
+	for i, code := range codes {
+		if api.isReservedShortCode(code) {
+			if codes[i], err = api.generateShortCode(); err != nil {
+				return nil, fmt.Errorf("failed to generate short codes: %w", err)
+			}
+		}
+	}
+
+	urls := make([]repository.URLs, len(items))
+	for i, item := range items {
+		shortCode := item.alias
+		if shortCode == "" {
+			shortCode, codes = codes[0], codes[1:]
+		}
+		urls[i] = repository.URLs{
+			ShortURL:  shortCode,
+			LongURL:   item.longURL,
+			ExpiresAt: item.expiresAt,
+		}
+	}
+
+	return urls, nil
+}
+
+// BatchShortenHandler handles POST requests to shorten an array of URLs at once
+func (api *UrlShortenerAPI) BatchShortenHandler(w http.ResponseWriter, r *http.Request) {
+	// batches get longer than single requests to cover the bulk insert
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	var reqs []ShortenRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqs); err != nil {
+		api.respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if len(reqs) == 0 {
+		api.respondWithError(w, http.StatusBadRequest, "Batch must contain at least one URL")
+		return
+	}
+
+	if len(reqs) > api.maxBatchSize {
+		api.respondWithError(w, http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("Batch must contain at most %d URLs", api.maxBatchSize))
+		return
+	}
+
+	results, err := api.shortenBatch(ctx, reqs)
+	if err != nil {
+		log.Printf("Error shortening URL batch: %v", err)
+		api.respondWithError(w, http.StatusInternalServerError, "Failed to shorten URLs")
+		return
+	}
+
+	api.respondWithJSON(w, http.StatusOK, BatchShortenResponse{Results: results})
+}
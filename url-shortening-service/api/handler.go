@@ -3,13 +3,14 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
-	"net/url"
 	"strings"
 	"time"
 
+	"github.com/gorilla/mux"
 	"github.com/oyinetare/url-shortener/cache"
 	"github.com/oyinetare/url-shortener/idgenerator"
 	"github.com/oyinetare/url-shortener/repository"
@@ -21,26 +22,129 @@ type UrlShortenerAPI struct {
 	baseURL     string
 	idgenerator idgenerator.IDGeneratorInterface
 	cache       cache.CacheInterface
+
+	// reverseCache maps long URLs to short codes for dedupe, nil when disabled
+	reverseCache cache.CacheInterface
+
+	aliasMinLength int
+	aliasMaxLength int
+	defaultTTL     time.Duration
+	negativeTTL    time.Duration
+	maxBatchSize   int
+	reservedCodes  map[string]bool
+	adminToken     string
+
+	// lookups coalesces concurrent database lookups of the same short code
+	lookups flightGroup
 }
 
-func NewUrlShortenerAPI(repo repository.RepositoryInterface, baseURL string, idGen idgenerator.IDGeneratorInterface, cache cache.CacheInterface) *UrlShortenerAPI {
-	return &UrlShortenerAPI{
-		repo:        repo,
-		baseURL:     baseURL,
-		idgenerator: idGen,
-		cache:       cache,
+// Option configures optional UrlShortenerAPI behaviour
+type Option func(*UrlShortenerAPI)
+
+// WithAliasLength sets the allowed length range for custom aliases
+func WithAliasLength(min, max int) Option {
+	return func(api *UrlShortenerAPI) {
+		if min > 0 && max >= min {
+			api.aliasMinLength = min
+			api.aliasMaxLength = max
+		}
+	}
+}
+
+// WithDefaultTTL sets the lifetime of links created without expiresAt or ttl, 0 means links never expire
+func WithDefaultTTL(ttl time.Duration) Option {
+	return func(api *UrlShortenerAPI) {
+		if ttl >= 0 {
+			api.defaultTTL = ttl
+		}
+	}
+}
+
+// WithNegativeCacheTTL sets how long an unknown short code is remembered as missing, 0 disables negative caching
+func WithNegativeCacheTTL(ttl time.Duration) Option {
+	return func(api *UrlShortenerAPI) {
+		if ttl >= 0 {
+			api.negativeTTL = ttl
+		}
 	}
 }
 
+// WithReverseCache sets the cache consulted for an existing short code before shortening a URL, nil disables it
+func WithReverseCache(c cache.CacheInterface) Option {
+	return func(api *UrlShortenerAPI) {
+		api.reverseCache = c
+	}
+}
+
+// WithAdminToken sets the bearer token required by the admin and link management endpoints, empty disables them
+func WithAdminToken(token string) Option {
+	return func(api *UrlShortenerAPI) {
+		api.adminToken = token
+	}
+}
+
+// WithMaxBatchSize sets the maximum number of items accepted by one batch shorten request
+func WithMaxBatchSize(n int) Option {
+	return func(api *UrlShortenerAPI) {
+		if n > 0 {
+			api.maxBatchSize = n
+		}
+	}
+}
+
+func NewUrlShortenerAPI(repo repository.RepositoryInterface, baseURL string, idGen idgenerator.IDGeneratorInterface, cache cache.CacheInterface, opts ...Option) *UrlShortenerAPI {
+	api := &UrlShortenerAPI{
+		repo:           repo,
+		baseURL:        baseURL,
+		idgenerator:    idGen,
+		cache:          cache,
+		aliasMinLength: defaultAliasMinLength,
+		aliasMaxLength: defaultAliasMaxLength,
+		negativeTTL:    defaultNegativeCacheTTL,
+		maxBatchSize:   defaultMaxBatchSize,
+		reservedCodes:  make(map[string]bool),
+	}
+	api.ReserveShortCodes(defaultReservedCodes...)
+
+	for _, opt := range opts {
+		opt(api)
+	}
+
+	return api
+}
+
 // ShortenRequest represents a request to shorten a URL
+// ExpiresAt and TTL (in seconds) are mutually exclusive, without either the default link TTL applies
 type ShortenRequest struct {
-	LongURL string `json:"longUrl"`
+	LongURL     string     `json:"longUrl"`
+	CustomAlias string     `json:"customAlias,omitempty"`
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty"`
+	TTL         int64      `json:"ttl,omitempty"`
 }
 
 // ShortenResponse represents a response with shortened URL
 type ShortenResponse struct {
-	ShortURL string `json:"shortUrl"`
-	LongURL  string `json:"longUrl"`
+	ShortURL  string     `json:"shortUrl"`
+	LongURL   string     `json:"longUrl"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// StatsResponse represents the click statistics of a short URL
+type StatsResponse struct {
+	ShortCode   string     `json:"shortCode"`
+	ShortURL    string     `json:"shortUrl"`
+	LongURL     string     `json:"longUrl"`
+	Clicks      int        `json:"clicks"`
+	CreatedAt   string     `json:"createdAt"`
+	LastClicked *time.Time `json:"lastClicked"`
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty"`
+	Disabled    bool       `json:"disabled"`
+}
+
+// UpdateLinkRequest represents a partial update of a short URL, omitted fields are left unchanged
+type UpdateLinkRequest struct {
+	LongURL  *string `json:"longUrl,omitempty"`
+	Disabled *bool   `json:"disabled,omitempty"`
 }
 
 // ErrorResponse represents an error response
@@ -49,18 +153,45 @@ type ErrorResponse struct {
 }
 
 // shorten creates a short URL for the given long URL
-func (api *UrlShortenerAPI) shorten(ctx context.Context, longUrl string) (string, error) {
+func (api *UrlShortenerAPI) shorten(ctx context.Context, req ShortenRequest) (ShortenResponse, error) {
+	longUrl := req.LongURL
+
 	// Validate URL
-	parsedURL, err := url.Parse(longUrl)
-	if err != nil || parsedURL.Scheme == "" || parsedURL.Host == "" {
-		return "", repository.ErrInvalidURL
+	if err := validateLongURL(longUrl); err != nil {
+		return ShortenResponse{}, err
+	}
+
+	expiresAt, err := api.resolveExpiry(req, time.Now())
+	if err != nil {
+		return ShortenResponse{}, err
 	}
 
-	// Check if URL already exists
+	// custom alias is saved as-is, a taken alias is reported rather than retried
+	if req.CustomAlias != "" {
+		if err := api.validateAlias(req.CustomAlias); err != nil {
+			return ShortenResponse{}, err
+		}
+
+		if err := api.repo.SaveUrls(ctx, req.CustomAlias, longUrl, expiresAt); err != nil {
+			return ShortenResponse{}, err
+		}
+
+		api.cacheURL(req.CustomAlias, longUrl, expiresAt)
+		return api.shortenResponse(req.CustomAlias, longUrl, expiresAt), nil
+	}
+
+	// Check if URL already exists, in the reverse cache first
+	if shortCode, existingExpiry, found := api.cachedShortCode(longUrl); found && canReuseLink(req, expiresAt, existingExpiry) {
+		return api.shortenResponse(shortCode, longUrl, existingExpiry), nil
+	}
+
+	// a link with a different lifetime than the one asked for isn't reused, the request gets its own
 	existing, err := api.repo.GetShortURLFromLong(ctx, longUrl)
-	if err == nil && existing != nil {
-		fullURL := fmt.Sprintf("%s/%s", api.baseURL, existing.ShortURL)
-		return fullURL, nil
+	if err == nil && existing != nil && canReuseLink(req, expiresAt, existing.ExpiresAt) {
+		if !hasExplicitExpiry(req) {
+			api.cacheShortCode(longUrl, existing.ShortURL, existing.ExpiresAt)
+		}
+		return api.shortenResponse(existing.ShortURL, longUrl, existing.ExpiresAt), nil
 	}
 
 	// else generate shortCode with collision detection
@@ -69,33 +200,74 @@ func (api *UrlShortenerAPI) shorten(ctx context.Context, longUrl string) (string
 
 	for i := 0; i < maxAttempts; i++ {
 
-		shortCode, err = api.idgenerator.GenerateShortCode()
+		shortCode, err = api.generateShortCode()
 		if err != nil {
-			return "", fmt.Errorf("failed to generate short code: %w", err)
+			return ShortenResponse{}, fmt.Errorf("failed to generate short code: %w", err)
 
 		}
 
 		// try save to db
-		err = api.repo.SaveUrls(ctx, shortCode, longUrl)
+		err = api.repo.SaveUrls(ctx, shortCode, longUrl, expiresAt)
 
 		if err == nil {
 			// Cache the new mapping
-			api.cache.Set(shortCode, longUrl)
+			api.cacheURL(shortCode, longUrl, expiresAt)
+			// a link with its own lifetime isn't what later default requests should be handed
+			if !hasExplicitExpiry(req) {
+				api.cacheShortCode(longUrl, shortCode, expiresAt)
+			}
 			break
 		}
 
 		if err != repository.ErrDuplicateShortCode {
-			return "", err
+			return ShortenResponse{}, err
 		}
 		// If duplicate, try again
 	}
 
 	if err != nil {
-		return "", fmt.Errorf("failed to create unique short code after %d attempts", maxAttempts)
+		return ShortenResponse{}, fmt.Errorf("failed to create unique short code after %d attempts", maxAttempts)
 	}
 
-	fullURL := fmt.Sprintf("%s/%s", api.baseURL, shortCode)
-	return fullURL, nil
+	return api.shortenResponse(shortCode, longUrl, expiresAt), nil
+}
+
+// generateShortCode generates a short code, skipping any that collide with a reserved path
+func (api *UrlShortenerAPI) generateShortCode() (string, error) {
+	maxAttempts := 5
+
+	for i := 0; i < maxAttempts; i++ {
+		shortCode, err := api.idgenerator.GenerateShortCode()
+		if err != nil || !api.isReservedShortCode(shortCode) {
+			return shortCode, err
+		}
+	}
+
+	return "", fmt.Errorf("generated only reserved short codes after %d attempts", maxAttempts)
+}
+
+// cacheURL caches a mapping so the entry never outlives the link's own expiry
+// also replaces any negative entry, so a code created after being probed resolves straight away
+func (api *UrlShortenerAPI) cacheURL(shortCode, longURL string, expiresAt *time.Time) {
+	if expiresAt != nil {
+		api.cache.SetWithExpiry(shortCode, longURL, *expiresAt)
+		return
+	}
+	api.cache.Set(shortCode, longURL)
+}
+
+// shortURL builds the public short URL for a short code using the configured base URL
+func (api *UrlShortenerAPI) shortURL(shortCode string) string {
+	return fmt.Sprintf("%s/%s", api.baseURL, shortCode)
+}
+
+// shortenResponse builds the response for a short code
+func (api *UrlShortenerAPI) shortenResponse(shortCode, longURL string, expiresAt *time.Time) ShortenResponse {
+	return ShortenResponse{
+		ShortURL:  api.shortURL(shortCode),
+		LongURL:   longURL,
+		ExpiresAt: expiresAt,
+	}
 }
 
 // ShortenHandler handles POST requests to shorten URLs
@@ -116,26 +288,38 @@ func (api *UrlShortenerAPI) ShortenHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	shortURL, err := api.shorten(ctx, req.LongURL)
+	resp, err := api.shorten(ctx, req)
 	if err != nil {
 		log.Printf("Error shortening URL: %v", err)
-		switch err {
-		case repository.ErrInvalidURL:
-			api.respondWithError(w, http.StatusBadRequest, "Invalid URL provided")
-		default:
-			api.respondWithError(w, http.StatusInternalServerError, "Failed to shorten URL")
-		}
+		status, message := api.shortenError(err)
+		api.respondWithError(w, status, message)
 		return
 	}
 
-	resp := ShortenResponse{
-		ShortURL: shortURL,
-		LongURL:  req.LongURL,
-	}
-
 	api.respondWithJSON(w, http.StatusCreated, resp)
 }
 
+// shortenError maps an error from shortening a URL to a status code and message
+func (api *UrlShortenerAPI) shortenError(err error) (int, string) {
+	switch err {
+	case repository.ErrInvalidURL:
+		return http.StatusBadRequest, "Invalid URL provided"
+	case ErrInvalidAlias:
+		return http.StatusBadRequest,
+			fmt.Sprintf("Custom alias must be %d-%d characters of [0-9a-zA-Z]", api.aliasMinLength, api.aliasMaxLength)
+	case ErrInvalidExpiry:
+		return http.StatusBadRequest,
+			fmt.Sprintf("expiresAt must be in the future and no later than %s, ttl 1-%d seconds, not both",
+				maxExpiresAt.Format(time.RFC3339), int64(maxLinkTTL/time.Second))
+	case ErrReservedAlias:
+		return http.StatusBadRequest, "Custom alias is reserved"
+	case repository.ErrDuplicateShortCode:
+		return http.StatusConflict, "Custom alias already in use"
+	default:
+		return http.StatusInternalServerError, "Failed to shorten URL"
+	}
+}
+
 // RedirectHandler handles GET requests to redirect to long URLs
 func (api *UrlShortenerAPI) RedirectHandler(w http.ResponseWriter, r *http.Request) {
 
@@ -151,45 +335,18 @@ func (api *UrlShortenerAPI) RedirectHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	// Check cache first
-	if longURL, found := api.cache.Get(shortCode); found {
-		log.Printf("Cache hit for short code: %s", shortCode)
-
-		// Still increment clicks asynchronously
-		go func() {
-			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-			defer cancel()
-			if err := api.repo.IncrementClicks(ctx, shortCode); err != nil {
-				log.Printf("Failed to increment clicks for %s: %v", shortCode, err)
-			}
-		}()
-
-		http.Redirect(w, r, longURL, http.StatusFound)
-		return
-	}
-
-	// Cache miss - fetch from database
-	log.Printf("Cache miss for short code: %s", shortCode)
-
-	// find longUrl
-	urlData, err := api.repo.GetLongURLFromShort(ctx, shortCode)
+	longURL, err := api.resolveLongURL(ctx, shortCode)
 	if err != nil {
-		switch err {
-		case repository.ErrURLNotFound:
+		if err == repository.ErrURLNotFound {
 			// use fallback if not found
 			http.NotFound(w, r)
-		case repository.ErrInvalidURL:
-			api.respondWithError(w, http.StatusBadRequest, err.Error())
-		default:
-			log.Printf("Unexpected error: %v", err)
-			api.respondWithError(w, http.StatusInternalServerError, "Failed to retrieve URL")
+			return
 		}
+		status, message := api.resolveError(err)
+		api.respondWithError(w, status, message)
 		return
 	}
 
-	// Update cache
-	api.cache.Set(shortCode, urlData.LongURL)
-
 	// increment click count with goroutine - best not to wait for it
 	go func() {
 		// https://go.dev/doc/database/cancel-operations
@@ -205,7 +362,221 @@ func (api *UrlShortenerAPI) RedirectHandler(w http.ResponseWriter, r *http.Reque
 	}()
 
 	// redirect to long URL
-	http.Redirect(w, r, urlData.LongURL, http.StatusFound)
+	http.Redirect(w, r, longURL, http.StatusFound)
+}
+
+// defaultNegativeCacheTTL is kept short because a code may be created through another replica's cache
+const defaultNegativeCacheTTL = 30 * time.Second
+
+// link states that resolve to 410 Gone rather than a redirect
+var (
+	errLinkDisabled = errors.New("link disabled")
+	errLinkExpired  = errors.New("link expired")
+)
+
+// resolveLongURL looks a short code up in the cache first, then the repository,
+// caching what it finds and rejecting disabled or expired links
+func (api *UrlShortenerAPI) resolveLongURL(ctx context.Context, shortCode string) (string, error) {
+	// Check cache first
+	if longURL, found := api.cache.Get(shortCode); found {
+		return longURL, nil
+	}
+
+	// Cache miss - fetch from database
+	// recently looked up and not found, spare the database
+	if api.cache.IsMissing(shortCode) {
+		return "", repository.ErrURLNotFound
+	}
+
+	return api.lookups.do(ctx, shortCode, 5*time.Second, func(ctx context.Context, store func(func())) (string, error) {
+		return api.loadLongURL(ctx, shortCode, store)
+	})
+}
+
+// loadLongURL fetches a short code from the repository and caches the outcome through store, found or not
+func (api *UrlShortenerAPI) loadLongURL(ctx context.Context, shortCode string, store func(func())) (string, error) {
+	// find longUrl
+	urlData, err := api.repo.GetLongURLFromShort(ctx, shortCode)
+	if err != nil {
+		if err == repository.ErrURLNotFound {
+			store(func() { api.cache.SetMissing(shortCode, api.negativeTTL) })
+		}
+		return "", err
+	}
+
+	if urlData.Disabled {
+		return "", errLinkDisabled
+	}
+
+	if urlData.IsExpired(time.Now()) {
+		return "", errLinkExpired
+	}
+
+	// Update cache
+	store(func() { api.cacheURL(shortCode, urlData.LongURL, urlData.ExpiresAt) })
+
+	return urlData.LongURL, nil
+}
+
+// resolveError maps an error from resolveLongURL to a status code and message
+func (api *UrlShortenerAPI) resolveError(err error) (int, string) {
+	switch err {
+	case repository.ErrURLNotFound:
+		return http.StatusNotFound, "Short URL not found"
+	case errLinkDisabled:
+		return http.StatusGone, "Short URL has been disabled"
+	case errLinkExpired:
+		return http.StatusGone, "Short URL has expired"
+	case repository.ErrInvalidURL:
+		return http.StatusBadRequest, err.Error()
+	default:
+		log.Printf("Unexpected error: %v", err)
+		return http.StatusInternalServerError, "Failed to retrieve URL"
+	}
+}
+
+// StatsHandler handles GET requests for the click statistics of a short URL
+func (api *UrlShortenerAPI) StatsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	shortCode := mux.Vars(r)["shortCode"]
+	if shortCode == "" {
+		api.respondWithError(w, http.StatusBadRequest, "Short code required")
+		return
+	}
+
+	urlData, err := api.repo.GetStats(ctx, shortCode)
+	if err != nil {
+		switch err {
+		case repository.ErrURLNotFound:
+			api.respondWithError(w, http.StatusNotFound, "Short URL not found")
+		default:
+			log.Printf("Unexpected error: %v", err)
+			api.respondWithError(w, http.StatusInternalServerError, "Failed to retrieve stats")
+		}
+		return
+	}
+
+	api.respondWithJSON(w, http.StatusOK, api.statsResponse(urlData))
+}
+
+// UpdateLinkHandler handles PATCH requests to change the destination of a short URL or disable it
+func (api *UrlShortenerAPI) UpdateLinkHandler(w http.ResponseWriter, r *http.Request) {
+	// an open link management API would let anyone repoint a trusted short link at a phishing page
+	if !api.authorizeAdmin(w, r) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	shortCode := mux.Vars(r)["shortCode"]
+
+	var req UpdateLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		api.respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.LongURL == nil && req.Disabled == nil {
+		api.respondWithError(w, http.StatusBadRequest, "Nothing to update")
+		return
+	}
+
+	if req.LongURL != nil {
+		if err := validateLongURL(*req.LongURL); err != nil {
+			api.respondWithError(w, http.StatusBadRequest, "Invalid URL provided")
+			return
+		}
+	}
+
+	// invalidate before and after the write so no request re-caches the old mapping in between
+	api.invalidate(shortCode)
+	defer api.invalidate(shortCode)
+
+	// the old destination must stop deduping to this code, whether it is changed or disabled
+	oldLongURL := api.currentLongURL(ctx, shortCode)
+	api.forgetLongURL(oldLongURL)
+	defer api.forgetLongURL(oldLongURL)
+
+	var err error
+	if req.LongURL != nil {
+		err = api.repo.UpdateLongURL(ctx, shortCode, *req.LongURL)
+	}
+	if err == nil && req.Disabled != nil {
+		err = api.repo.SetDisabled(ctx, shortCode, *req.Disabled)
+	}
+	if err != nil {
+		api.respondWithLinkError(w, err, "Failed to update short URL")
+		return
+	}
+
+	urlData, err := api.repo.GetStats(ctx, shortCode)
+	if err != nil {
+		api.respondWithLinkError(w, err, "Failed to update short URL")
+		return
+	}
+
+	api.respondWithJSON(w, http.StatusOK, api.statsResponse(urlData))
+}
+
+// DeleteLinkHandler handles DELETE requests to soft-delete a short URL
+func (api *UrlShortenerAPI) DeleteLinkHandler(w http.ResponseWriter, r *http.Request) {
+	if !api.authorizeAdmin(w, r) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	shortCode := mux.Vars(r)["shortCode"]
+
+	api.invalidate(shortCode)
+	defer api.invalidate(shortCode)
+
+	oldLongURL := api.currentLongURL(ctx, shortCode)
+	api.forgetLongURL(oldLongURL)
+	defer api.forgetLongURL(oldLongURL)
+
+	if err := api.repo.DeleteUrls(ctx, shortCode); err != nil {
+		api.respondWithLinkError(w, err, "Failed to delete short URL")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// invalidate drops a short code from the cache, along with the result of any lookup of it still in flight,
+// which may have read the row before the change being made
+func (api *UrlShortenerAPI) invalidate(shortCode string) {
+	api.lookups.forget(shortCode)
+	api.cache.Delete(shortCode)
+}
+
+// statsResponse builds the stats representation of a stored URL mapping
+func (api *UrlShortenerAPI) statsResponse(urlData *repository.URLs) StatsResponse {
+	return StatsResponse{
+		ShortCode:   urlData.ShortURL,
+		ShortURL:    api.shortURL(urlData.ShortURL),
+		LongURL:     urlData.LongURL,
+		Clicks:      urlData.Clicks,
+		CreatedAt:   urlData.CreatedAt,
+		LastClicked: urlData.LastClicked,
+		ExpiresAt:   urlData.ExpiresAt,
+		Disabled:    urlData.Disabled,
+	}
+}
+
+// respondWithLinkError maps repository errors from link management to an error response
+func (api *UrlShortenerAPI) respondWithLinkError(w http.ResponseWriter, err error, message string) {
+	switch err {
+	case repository.ErrURLNotFound:
+		api.respondWithError(w, http.StatusNotFound, "Short URL not found")
+	default:
+		log.Printf("Unexpected error: %v", err)
+		api.respondWithError(w, http.StatusInternalServerError, message)
+	}
 }
 
 // respondWithJSON is helper fucntion to send a JSON response
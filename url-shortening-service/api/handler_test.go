@@ -4,8 +4,11 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -16,17 +19,26 @@ import (
 	"github.com/oyinetare/url-shortener/repository"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 type MockRepository struct {
 	mock.Mock
 }
 
-func (m *MockRepository) SaveUrls(ctx context.Context, shortUrl, longUrl string) error {
-	args := m.Called(ctx, shortUrl, longUrl)
+func (m *MockRepository) SaveUrls(ctx context.Context, shortUrl, longUrl string, expiresAt *time.Time) error {
+	args := m.Called(ctx, shortUrl, longUrl, expiresAt)
 	return args.Error(0)
 }
 
+func (m *MockRepository) SaveUrlsBatch(ctx context.Context, urls []repository.URLs) ([]error, error) {
+	args := m.Called(ctx, urls)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]error), args.Error(1)
+}
+
 func (m *MockRepository) GetShortURLFromLong(ctx context.Context, longUrl string) (*repository.URLs, error) {
 	args := m.Called(ctx, longUrl)
 	if args.Get(0) == nil {
@@ -48,11 +60,59 @@ func (m *MockRepository) IncrementClicks(ctx context.Context, shortUrl string) e
 	return args.Error(0)
 }
 
+func (m *MockRepository) GetStats(ctx context.Context, shortUrl string) (*repository.URLs, error) {
+	args := m.Called(ctx, shortUrl)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*repository.URLs), args.Error(1)
+}
+
+func (m *MockRepository) GetTopURLs(ctx context.Context, limit int) ([]repository.URLs, error) {
+	args := m.Called(ctx, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]repository.URLs), args.Error(1)
+}
+
+func (m *MockRepository) UpdateLongURL(ctx context.Context, shortUrl, longUrl string) error {
+	args := m.Called(ctx, shortUrl, longUrl)
+	return args.Error(0)
+}
+
+func (m *MockRepository) SetDisabled(ctx context.Context, shortUrl string, disabled bool) error {
+	args := m.Called(ctx, shortUrl, disabled)
+	return args.Error(0)
+}
+
+func (m *MockRepository) DeleteUrls(ctx context.Context, shortUrl string) error {
+	args := m.Called(ctx, shortUrl)
+	return args.Error(0)
+}
+
 func (m *MockRepository) Disconnect() error {
 	args := m.Called()
 	return args.Error(0)
 }
 
+// stubGenerator hands out a fixed sequence of short codes
+type stubGenerator struct {
+	codes []string
+}
+
+func (g *stubGenerator) GenerateShortCode() (string, error) {
+	code := g.codes[0]
+	g.codes = g.codes[1:]
+	return code, nil
+}
+
+func (g *stubGenerator) GenerateShortCodes(n int) ([]string, error) {
+	codes := g.codes[:n]
+	g.codes = g.codes[n:]
+	return codes, nil
+}
+
 func TestShortenHandler(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -67,7 +127,7 @@ func TestShortenHandler(t *testing.T) {
 			mockSetup: func(m *MockRepository) {
 				m.On("GetShortURLFromLong", mock.Anything, "https://example.com").
 					Return(nil, repository.ErrURLNotFound)
-				m.On("SaveUrls", mock.Anything, mock.Anything, "https://example.com").
+				m.On("SaveUrls", mock.Anything, mock.Anything, "https://example.com", mock.Anything).
 					Return(nil)
 			},
 			expectedStatus: http.StatusCreated,
@@ -101,6 +161,139 @@ func TestShortenHandler(t *testing.T) {
 				"error": "Invalid URL provided",
 			},
 		},
+		{
+			name:        "custom alias",
+			requestBody: `{"longUrl":"https://example.com","customAlias":"myLink1"}`,
+			mockSetup: func(m *MockRepository) {
+				m.On("SaveUrls", mock.Anything, "myLink1", "https://example.com", mock.Anything).
+					Return(nil)
+			},
+			expectedStatus: http.StatusCreated,
+			expectedBody: map[string]interface{}{
+				"shortUrl": "http://localhost:8080/myLink1",
+				"longUrl":  "https://example.com",
+			},
+		},
+		{
+			name:        "custom alias already taken",
+			requestBody: `{"longUrl":"https://example.com","customAlias":"taken1"}`,
+			mockSetup: func(m *MockRepository) {
+				m.On("SaveUrls", mock.Anything, "taken1", "https://example.com", mock.Anything).
+					Return(repository.ErrDuplicateShortCode).Once()
+			},
+			expectedStatus: http.StatusConflict,
+			expectedBody: map[string]interface{}{
+				"error": "Custom alias already in use",
+			},
+		},
+		{
+			name:           "custom alias with invalid characters",
+			requestBody:    `{"longUrl":"https://example.com","customAlias":"my-link"}`,
+			mockSetup:      func(m *MockRepository) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{
+				"error": "Custom alias must be 4-20 characters of [0-9a-zA-Z]",
+			},
+		},
+		{
+			name:           "custom alias too short",
+			requestBody:    `{"longUrl":"https://example.com","customAlias":"ab"}`,
+			mockSetup:      func(m *MockRepository) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{
+				"error": "Custom alias must be 4-20 characters of [0-9a-zA-Z]",
+			},
+		},
+		{
+			name:           "reserved custom alias",
+			requestBody:    `{"longUrl":"https://example.com","customAlias":"Shorten"}`,
+			mockSetup:      func(m *MockRepository) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{
+				"error": "Custom alias is reserved",
+			},
+		},
+		{
+			name:        "explicit ttl",
+			requestBody: `{"longUrl":"https://example.com","customAlias":"ttlLink","ttl":3600}`,
+			mockSetup: func(m *MockRepository) {
+				m.On("SaveUrls", mock.Anything, "ttlLink", "https://example.com",
+					mock.MatchedBy(func(expiresAt *time.Time) bool {
+						return expiresAt != nil && time.Until(*expiresAt) > 59*time.Minute && time.Until(*expiresAt) <= time.Hour
+					})).Return(nil)
+			},
+			expectedStatus: http.StatusCreated,
+			expectedBody: map[string]interface{}{
+				"shortUrl": "http://localhost:8080/ttlLink",
+			},
+		},
+		{
+			name:        "explicit ttl for a URL with a default link",
+			requestBody: `{"longUrl":"https://example.com","ttl":3600}`,
+			mockSetup: func(m *MockRepository) {
+				defaultExpiry := time.Now().Add(30 * 24 * time.Hour)
+				m.On("GetShortURLFromLong", mock.Anything, "https://example.com").
+					Return(&repository.URLs{ShortURL: "existing123", LongURL: "https://example.com", ExpiresAt: &defaultExpiry}, nil)
+				m.On("SaveUrls", mock.Anything, mock.MatchedBy(func(code string) bool { return code != "existing123" }), "https://example.com",
+					mock.MatchedBy(func(expiresAt *time.Time) bool {
+						return expiresAt != nil && time.Until(*expiresAt) > 59*time.Minute && time.Until(*expiresAt) <= time.Hour
+					})).Return(nil)
+			},
+			expectedStatus: http.StatusCreated,
+			expectedBody: map[string]interface{}{
+				"longUrl": "https://example.com",
+			},
+		},
+		{
+			name:        "explicit expiresAt matching the existing link",
+			requestBody: `{"longUrl":"https://example.com","expiresAt":"2037-01-01T00:00:00Z"}`,
+			mockSetup: func(m *MockRepository) {
+				expiry := time.Date(2037, time.January, 1, 0, 0, 0, 0, time.UTC)
+				m.On("GetShortURLFromLong", mock.Anything, "https://example.com").
+					Return(&repository.URLs{ShortURL: "existing123", LongURL: "https://example.com", ExpiresAt: &expiry}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+			expectedBody: map[string]interface{}{
+				"shortUrl": "http://localhost:8080/existing123",
+				"longUrl":  "https://example.com",
+			},
+		},
+		{
+			name:           "expiresAt in the past",
+			requestBody:    `{"longUrl":"https://example.com","expiresAt":"2001-01-01T00:00:00Z"}`,
+			mockSetup:      func(m *MockRepository) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{
+				"error": "expiresAt must be in the future and no later than 2038-01-19T03:14:07Z, ttl 1-315360000 seconds, not both",
+			},
+		},
+		{
+			name:           "expiresAt past the column range",
+			requestBody:    `{"longUrl":"https://example.com","expiresAt":"2999-01-01T00:00:00Z"}`,
+			mockSetup:      func(m *MockRepository) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{
+				"error": "expiresAt must be in the future and no later than 2038-01-19T03:14:07Z, ttl 1-315360000 seconds, not both",
+			},
+		},
+		{
+			name:           "ttl above the maximum",
+			requestBody:    `{"longUrl":"https://example.com","ttl":10000000000}`,
+			mockSetup:      func(m *MockRepository) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{
+				"error": "expiresAt must be in the future and no later than 2038-01-19T03:14:07Z, ttl 1-315360000 seconds, not both",
+			},
+		},
+		{
+			name:           "both expiresAt and ttl",
+			requestBody:    `{"longUrl":"https://example.com","expiresAt":"2037-01-01T00:00:00Z","ttl":60}`,
+			mockSetup:      func(m *MockRepository) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{
+				"error": "expiresAt must be in the future and no later than 2038-01-19T03:14:07Z, ttl 1-315360000 seconds, not both",
+			},
+		},
 		{
 			name:           "invalid JSON",
 			requestBody:    `{invalid json}`,
@@ -124,7 +317,8 @@ func TestShortenHandler(t *testing.T) {
 
 			cache := cache.NewInMemoryCache(time.Hour)
 			// idgenerator := idgenerator.NewMD5Generator(7)
-			idgenerator := idgenerator.NewSnowflakeGenerator()
+			idgenerator, err := idgenerator.NewSnowflakeGenerator(0)
+			require.NoError(t, err)
 			api := NewUrlShortenerAPI(mockRepo, cfg.BaseURL, idgenerator, cache)
 
 			// Create request
@@ -139,7 +333,7 @@ func TestShortenHandler(t *testing.T) {
 			assert.Equal(t, tt.expectedStatus, w.Code)
 
 			var response map[string]interface{}
-			err := json.Unmarshal(w.Body.Bytes(), &response)
+			err = json.Unmarshal(w.Body.Bytes(), &response)
 			assert.NoError(t, err)
 
 			// Check expected fields
@@ -159,6 +353,27 @@ func TestShortenHandler(t *testing.T) {
 	}
 }
 
+func TestShortenSkipsReservedCodes(t *testing.T) {
+	mockRepo := new(MockRepository)
+	mockRepo.On("GetShortURLFromLong", mock.Anything, "https://example.com").
+		Return(nil, repository.ErrURLNotFound)
+	mockRepo.On("SaveUrls", mock.Anything, "good1234", "https://example.com", mock.Anything).
+		Return(nil)
+
+	cache := cache.NewInMemoryCache(time.Hour)
+	generator := &stubGenerator{codes: []string{"api", "links", "good1234"}}
+	api := NewUrlShortenerAPI(mockRepo, "http://localhost:8080", generator, cache)
+	api.ReserveShortCodes("links")
+
+	req := httptest.NewRequest("POST", "/api/v1/shorten", bytes.NewBufferString(`{"longUrl":"https://example.com"}`))
+	w := httptest.NewRecorder()
+	api.ShortenHandler(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, w.Body.String(), "http://localhost:8080/good1234")
+	mockRepo.AssertExpectations(t)
+}
+
 func TestRedirectHandler(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -182,6 +397,35 @@ func TestRedirectHandler(t *testing.T) {
 			expectedStatus: http.StatusFound,
 			expectedHeader: "https://example.com",
 		},
+		{
+			name:      "expired URL",
+			shortCode: "expired1",
+			mockSetup: func(m *MockRepository) {
+				expiredAt := time.Now().Add(-time.Hour)
+				m.On("GetLongURLFromShort", mock.Anything, "expired1").
+					Return(&repository.URLs{
+						ShortURL:  "expired1",
+						LongURL:   "https://example.com",
+						ExpiresAt: &expiredAt,
+					}, nil)
+			},
+			expectedStatus: http.StatusGone,
+			expectedHeader: "",
+		},
+		{
+			name:      "disabled URL",
+			shortCode: "disabled1",
+			mockSetup: func(m *MockRepository) {
+				m.On("GetLongURLFromShort", mock.Anything, "disabled1").
+					Return(&repository.URLs{
+						ShortURL: "disabled1",
+						LongURL:  "https://example.com",
+						Disabled: true,
+					}, nil)
+			},
+			expectedStatus: http.StatusGone,
+			expectedHeader: "",
+		},
 		{
 			name:      "URL not found",
 			shortCode: "notfound",
@@ -228,3 +472,1215 @@ func TestRedirectHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestRedirectNegativeCache(t *testing.T) {
+	tests := []struct {
+		name            string
+		opts            []Option
+		expectedLookups int
+	}{
+		{
+			name:            "unknown code is looked up once",
+			expectedLookups: 1,
+		},
+		{
+			name:            "negative caching disabled",
+			opts:            []Option{WithNegativeCacheTTL(0)},
+			expectedLookups: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockRepository)
+			mockRepo.On("GetLongURLFromShort", mock.Anything, "probe123").
+				Return(nil, repository.ErrURLNotFound).Times(tt.expectedLookups)
+
+			cache := cache.NewInMemoryCache(time.Hour)
+			api := NewUrlShortenerAPI(mockRepo, "http://localhost:8080", idgenerator.NewMD5Generator(7), cache, tt.opts...)
+
+			router := mux.NewRouter()
+			router.HandleFunc("/{shortCode}", api.RedirectHandler)
+
+			for i := 0; i < 3; i++ {
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, httptest.NewRequest("GET", "/probe123", nil))
+				assert.Equal(t, http.StatusNotFound, w.Code)
+			}
+
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestShortenClearsNegativeCache(t *testing.T) {
+	mockRepo := new(MockRepository)
+	mockRepo.On("GetLongURLFromShort", mock.Anything, "probe123").
+		Return(nil, repository.ErrURLNotFound).Once()
+	mockRepo.On("SaveUrls", mock.Anything, "probe123", "https://example.com", mock.Anything).
+		Return(nil)
+	mockRepo.On("IncrementClicks", mock.Anything, "probe123").
+		Return(nil).Maybe()
+
+	cache := cache.NewInMemoryCache(time.Hour)
+	api := NewUrlShortenerAPI(mockRepo, "http://localhost:8080", idgenerator.NewMD5Generator(7), cache)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/{shortCode}", api.RedirectHandler)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/probe123", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	api.ShortenHandler(w, httptest.NewRequest("POST", "/api/v1/shorten",
+		bytes.NewBufferString(`{"longUrl":"https://example.com","customAlias":"probe123"}`)))
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	// resolves from the cache without another lookup
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/probe123", nil))
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "https://example.com", w.Header().Get("Location"))
+
+	time.Sleep(10 * time.Millisecond)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestRedirectCoalescesLookups(t *testing.T) {
+	tests := []struct {
+		name           string
+		lookupResult   *repository.URLs
+		lookupErr      error
+		expectedStatus int
+	}{
+		{
+			name:           "waiters share the result",
+			lookupResult:   &repository.URLs{ShortURL: "viral1", LongURL: "https://example.com"},
+			expectedStatus: http.StatusFound,
+		},
+		{
+			name:           "waiters share the error",
+			lookupErr:      errors.New("database unavailable"),
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			release := make(chan time.Time)
+			mockRepo := new(MockRepository)
+			mockRepo.On("GetLongURLFromShort", mock.Anything, "viral1").
+				WaitUntil(release).
+				Return(tt.lookupResult, tt.lookupErr).Once()
+			mockRepo.On("IncrementClicks", mock.Anything, "viral1").
+				Return(nil).Maybe()
+
+			cache := cache.NewInMemoryCache(time.Hour)
+			api := NewUrlShortenerAPI(mockRepo, "http://localhost:8080", idgenerator.NewMD5Generator(7), cache)
+
+			router := mux.NewRouter()
+			router.HandleFunc("/{shortCode}", api.RedirectHandler)
+
+			const requests = 50
+			statuses := make(chan int, requests)
+			var started sync.WaitGroup
+			for i := 0; i < requests; i++ {
+				started.Add(1)
+				go func() {
+					started.Done()
+					w := httptest.NewRecorder()
+					router.ServeHTTP(w, httptest.NewRequest("GET", "/viral1", nil))
+					statuses <- w.Code
+				}()
+			}
+
+			// let every request reach the lookup before it completes
+			started.Wait()
+			time.Sleep(50 * time.Millisecond)
+			close(release)
+
+			for i := 0; i < requests; i++ {
+				assert.Equal(t, tt.expectedStatus, <-statuses)
+			}
+
+			time.Sleep(10 * time.Millisecond)
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestFlightGroupWaiterCancel(t *testing.T) {
+	var group flightGroup
+	release := make(chan struct{})
+	first := make(chan string, 1)
+
+	go func() {
+		value, _ := group.do(context.Background(), "key", time.Second, func(ctx context.Context, store func(func())) (string, error) {
+			<-release
+			return "value", nil
+		})
+		first <- value
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	// a waiter giving up stops waiting without cancelling the shared lookup
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := group.do(ctx, "key", time.Second, func(ctx context.Context, store func(func())) (string, error) {
+		t.Error("lookup should be shared")
+		return "", nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+
+	close(release)
+	assert.Equal(t, "value", <-first)
+}
+
+func TestFlightGroupForget(t *testing.T) {
+	var group flightGroup
+	release := make(chan struct{})
+	first := make(chan string, 1)
+	stored := false
+
+	go func() {
+		value, _ := group.do(context.Background(), "key", time.Second, func(ctx context.Context, store func(func())) (string, error) {
+			<-release
+			store(func() { stored = true })
+			return "old", nil
+		})
+		first <- value
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	group.forget("key")
+
+	// a lookup after the invalidation doesn't share the one that started before it
+	value, err := group.do(context.Background(), "key", time.Second, func(ctx context.Context, store func(func())) (string, error) {
+		return "new", nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "new", value)
+
+	close(release)
+	assert.Equal(t, "old", <-first)
+	assert.False(t, stored)
+}
+
+func TestUpdateLinkDiscardsInFlightLookup(t *testing.T) {
+	release := make(chan time.Time)
+	mockRepo := new(MockRepository)
+	mockRepo.On("GetLongURLFromShort", mock.Anything, "abc123").
+		WaitUntil(release).
+		Return(&repository.URLs{ShortURL: "abc123", LongURL: "https://example.com"}, nil).Once()
+	mockRepo.On("IncrementClicks", mock.Anything, "abc123").Return(nil).Maybe()
+	mockRepo.On("UpdateLongURL", mock.Anything, "abc123", "https://example.org").Return(nil)
+	mockRepo.On("GetStats", mock.Anything, "abc123").
+		Return(&repository.URLs{ShortURL: "abc123", LongURL: "https://example.org"}, nil)
+
+	cache := cache.NewInMemoryCache(time.Hour)
+	api := NewUrlShortenerAPI(mockRepo, "http://localhost:8080", idgenerator.NewMD5Generator(7), cache, WithAdminToken("s3cret"))
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/v1/links/{shortCode}", api.UpdateLinkHandler).Methods("PATCH")
+	router.HandleFunc("/{shortCode}", api.RedirectHandler).Methods("GET")
+
+	// a redirect reads the old row, then the link is updated before its lookup finishes
+	redirected := make(chan int, 1)
+	go func() {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/abc123", nil))
+		redirected <- w.Code
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	req := httptest.NewRequest("PATCH", "/api/v1/links/abc123", bytes.NewBufferString(`{"longUrl":"https://example.org"}`))
+	req.Header.Set("Authorization", "Bearer s3cret")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	close(release)
+	assert.Equal(t, http.StatusFound, <-redirected)
+
+	_, found := cache.Get("abc123")
+	assert.False(t, found, "the old destination must not be cached after the update")
+
+	time.Sleep(10 * time.Millisecond)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestStatsHandler(t *testing.T) {
+	lastClicked := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name           string
+		shortCode      string
+		mockSetup      func(*MockRepository)
+		expectedStatus int
+		expectedBody   map[string]interface{}
+	}{
+		{
+			name:      "returns stats",
+			shortCode: "abc123",
+			mockSetup: func(m *MockRepository) {
+				m.On("GetStats", mock.Anything, "abc123").
+					Return(&repository.URLs{
+						ShortURL:    "abc123",
+						LongURL:     "https://example.com",
+						CreatedAt:   "2025-01-01T00:00:00Z",
+						Clicks:      42,
+						LastClicked: &lastClicked,
+					}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody: map[string]interface{}{
+				"shortCode":   "abc123",
+				"shortUrl":    "http://localhost:8080/abc123",
+				"longUrl":     "https://example.com",
+				"clicks":      float64(42),
+				"createdAt":   "2025-01-01T00:00:00Z",
+				"lastClicked": "2025-06-01T12:00:00Z",
+			},
+		},
+		{
+			name:      "never clicked",
+			shortCode: "fresh1",
+			mockSetup: func(m *MockRepository) {
+				m.On("GetStats", mock.Anything, "fresh1").
+					Return(&repository.URLs{
+						ShortURL:  "fresh1",
+						LongURL:   "https://example.com",
+						CreatedAt: "2025-01-01T00:00:00Z",
+					}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody: map[string]interface{}{
+				"clicks":      float64(0),
+				"lastClicked": nil,
+			},
+		},
+		{
+			name:      "URL not found",
+			shortCode: "notfound",
+			mockSetup: func(m *MockRepository) {
+				m.On("GetStats", mock.Anything, "notfound").
+					Return(nil, repository.ErrURLNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedBody: map[string]interface{}{
+				"error": "Short URL not found",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup
+			mockRepo := new(MockRepository)
+			tt.mockSetup(mockRepo)
+
+			cache := cache.NewInMemoryCache(time.Hour)
+			idgenerator := idgenerator.NewMD5Generator(7)
+			api := NewUrlShortenerAPI(mockRepo, "http://localhost:8080", idgenerator, cache)
+
+			req := httptest.NewRequest("GET", "/api/v1/links/"+tt.shortCode+"/stats", nil)
+			w := httptest.NewRecorder()
+
+			router := mux.NewRouter()
+			router.HandleFunc("/api/v1/links/{shortCode}/stats", api.StatsHandler)
+			router.ServeHTTP(w, req)
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			var response map[string]interface{}
+			err := json.Unmarshal(w.Body.Bytes(), &response)
+			assert.NoError(t, err)
+
+			for key, value := range tt.expectedBody {
+				assert.Equal(t, value, response[key])
+			}
+
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestUpdateLinkHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		requestBody    string
+		mockSetup      func(*MockRepository)
+		expectedStatus int
+		expectedBody   map[string]interface{}
+	}{
+		{
+			name:        "update destination",
+			requestBody: `{"longUrl":"https://example.org"}`,
+			mockSetup: func(m *MockRepository) {
+				m.On("UpdateLongURL", mock.Anything, "abc123", "https://example.org").Return(nil)
+				m.On("GetStats", mock.Anything, "abc123").
+					Return(&repository.URLs{ShortURL: "abc123", LongURL: "https://example.org"}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody: map[string]interface{}{
+				"longUrl":  "https://example.org",
+				"disabled": false,
+			},
+		},
+		{
+			name:        "disable link",
+			requestBody: `{"disabled":true}`,
+			mockSetup: func(m *MockRepository) {
+				m.On("SetDisabled", mock.Anything, "abc123", true).Return(nil)
+				m.On("GetStats", mock.Anything, "abc123").
+					Return(&repository.URLs{ShortURL: "abc123", LongURL: "https://example.com", Disabled: true}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody: map[string]interface{}{
+				"disabled": true,
+			},
+		},
+		{
+			name:        "link not found",
+			requestBody: `{"disabled":true}`,
+			mockSetup: func(m *MockRepository) {
+				m.On("SetDisabled", mock.Anything, "abc123", true).Return(repository.ErrURLNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedBody: map[string]interface{}{
+				"error": "Short URL not found",
+			},
+		},
+		{
+			name:           "invalid destination",
+			requestBody:    `{"longUrl":"not-a-url"}`,
+			mockSetup:      func(m *MockRepository) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{
+				"error": "Invalid URL provided",
+			},
+		},
+		{
+			name:           "empty update",
+			requestBody:    `{}`,
+			mockSetup:      func(m *MockRepository) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody: map[string]interface{}{
+				"error": "Nothing to update",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup
+			mockRepo := new(MockRepository)
+			tt.mockSetup(mockRepo)
+
+			cache := cache.NewInMemoryCache(time.Hour)
+			cache.Set("abc123", "https://example.com")
+			idgenerator := idgenerator.NewMD5Generator(7)
+			api := NewUrlShortenerAPI(mockRepo, "http://localhost:8080", idgenerator, cache, WithAdminToken("s3cret"))
+
+			req := httptest.NewRequest("PATCH", "/api/v1/links/abc123", bytes.NewBufferString(tt.requestBody))
+			req.Header.Set("Authorization", "Bearer s3cret")
+			w := httptest.NewRecorder()
+
+			router := mux.NewRouter()
+			router.HandleFunc("/api/v1/links/{shortCode}", api.UpdateLinkHandler)
+			router.ServeHTTP(w, req)
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			var response map[string]interface{}
+			err := json.Unmarshal(w.Body.Bytes(), &response)
+			assert.NoError(t, err)
+
+			for key, value := range tt.expectedBody {
+				assert.Equal(t, value, response[key])
+			}
+
+			// a successful update must invalidate the cached mapping
+			if tt.expectedStatus == http.StatusOK {
+				_, found := cache.Get("abc123")
+				assert.False(t, found)
+			}
+
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestDeleteLinkHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		mockSetup      func(*MockRepository)
+		expectedStatus int
+	}{
+		{
+			name: "deletes link",
+			mockSetup: func(m *MockRepository) {
+				m.On("DeleteUrls", mock.Anything, "abc123").Return(nil)
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name: "link not found",
+			mockSetup: func(m *MockRepository) {
+				m.On("DeleteUrls", mock.Anything, "abc123").Return(repository.ErrURLNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup
+			mockRepo := new(MockRepository)
+			tt.mockSetup(mockRepo)
+
+			cache := cache.NewInMemoryCache(time.Hour)
+			cache.Set("abc123", "https://example.com")
+			idgenerator := idgenerator.NewMD5Generator(7)
+			api := NewUrlShortenerAPI(mockRepo, "http://localhost:8080", idgenerator, cache, WithAdminToken("s3cret"))
+
+			req := httptest.NewRequest("DELETE", "/api/v1/links/abc123", nil)
+			req.Header.Set("Authorization", "Bearer s3cret")
+			w := httptest.NewRecorder()
+
+			router := mux.NewRouter()
+			router.HandleFunc("/api/v1/links/{shortCode}", api.DeleteLinkHandler)
+			router.ServeHTTP(w, req)
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			_, found := cache.Get("abc123")
+			assert.False(t, found)
+
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestLinkManagementRequiresAdminToken(t *testing.T) {
+	tests := []struct {
+		name           string
+		adminToken     string
+		method         string
+		authorization  string
+		expectedStatus int
+	}{
+		{
+			name:           "update disabled without a configured token",
+			method:         "PATCH",
+			authorization:  "Bearer ",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "update without a token",
+			adminToken:     "s3cret",
+			method:         "PATCH",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "update with the wrong token",
+			adminToken:     "s3cret",
+			method:         "PATCH",
+			authorization:  "Bearer guess",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "delete disabled without a configured token",
+			method:         "DELETE",
+			authorization:  "Bearer ",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "delete without a token",
+			adminToken:     "s3cret",
+			method:         "DELETE",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "delete with the wrong token",
+			adminToken:     "s3cret",
+			method:         "DELETE",
+			authorization:  "Bearer guess",
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// no expectations, the repository must not be touched
+			mockRepo := new(MockRepository)
+
+			cache := cache.NewInMemoryCache(time.Hour)
+			cache.Set("abc123", "https://example.com")
+			api := NewUrlShortenerAPI(mockRepo, "http://localhost:8080", idgenerator.NewMD5Generator(7), cache,
+				WithAdminToken(tt.adminToken))
+
+			router := mux.NewRouter()
+			router.HandleFunc("/api/v1/links/{shortCode}", api.UpdateLinkHandler).Methods("PATCH")
+			router.HandleFunc("/api/v1/links/{shortCode}", api.DeleteLinkHandler).Methods("DELETE")
+
+			req := httptest.NewRequest(tt.method, "/api/v1/links/abc123", bytes.NewBufferString(`{"longUrl":"https://phish.example"}`))
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			longURL, found := cache.Get("abc123")
+			assert.True(t, found)
+			assert.Equal(t, "https://example.com", longURL)
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestBatchShortenHandler(t *testing.T) {
+	tests := []struct {
+		name            string
+		requestBody     string
+		mockSetup       func(*MockRepository)
+		expectedStatus  int
+		expectedErrors  []string
+		expectedShorten []bool
+	}{
+		{
+			name:        "mixed valid and invalid items",
+			requestBody: `[{"longUrl":"https://example.com"},{"longUrl":"not-a-url"},{"longUrl":"https://example.org","customAlias":"myAlias"}]`,
+			mockSetup: func(m *MockRepository) {
+				m.On("SaveUrlsBatch", mock.Anything, mock.MatchedBy(func(urls []repository.URLs) bool {
+					return len(urls) == 2 && urls[1].ShortURL == "myAlias"
+				})).Return([]error{nil, nil}, nil)
+			},
+			expectedStatus:  http.StatusOK,
+			expectedErrors:  []string{"", "Invalid URL provided", ""},
+			expectedShorten: []bool{true, false, true},
+		},
+		{
+			name:        "taken alias fails, colliding generated code is retried",
+			requestBody: `[{"longUrl":"https://example.com"},{"longUrl":"https://example.org","customAlias":"taken1"}]`,
+			mockSetup: func(m *MockRepository) {
+				m.On("SaveUrlsBatch", mock.Anything, mock.MatchedBy(func(urls []repository.URLs) bool {
+					return len(urls) == 2
+				})).Return([]error{repository.ErrDuplicateShortCode, repository.ErrDuplicateShortCode}, nil).Once()
+				m.On("SaveUrlsBatch", mock.Anything, mock.MatchedBy(func(urls []repository.URLs) bool {
+					return len(urls) == 1 && urls[0].LongURL == "https://example.com"
+				})).Return([]error{nil}, nil).Once()
+			},
+			expectedStatus:  http.StatusOK,
+			expectedErrors:  []string{"", "Custom alias already in use"},
+			expectedShorten: []bool{true, false},
+		},
+		{
+			name:           "empty batch",
+			requestBody:    `[]`,
+			mockSetup:      func(m *MockRepository) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "too many items",
+			requestBody:    `[{"longUrl":"https://a.com"},{"longUrl":"https://b.com"},{"longUrl":"https://c.com"},{"longUrl":"https://d.com"}]`,
+			mockSetup:      func(m *MockRepository) {},
+			expectedStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:        "transaction failure",
+			requestBody: `[{"longUrl":"https://example.com"}]`,
+			mockSetup: func(m *MockRepository) {
+				m.On("SaveUrlsBatch", mock.Anything, mock.Anything).
+					Return(nil, assert.AnError)
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup
+			mockRepo := new(MockRepository)
+			tt.mockSetup(mockRepo)
+
+			cache := cache.NewInMemoryCache(time.Hour)
+			idgenerator, err := idgenerator.NewSnowflakeGenerator(0)
+			require.NoError(t, err)
+			api := NewUrlShortenerAPI(mockRepo, "http://localhost:8080", idgenerator, cache, WithMaxBatchSize(3))
+
+			req := httptest.NewRequest("POST", "/api/v1/shorten/batch", bytes.NewBufferString(tt.requestBody))
+			w := httptest.NewRecorder()
+
+			// Execute
+			api.BatchShortenHandler(w, req)
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			if tt.expectedStatus == http.StatusOK {
+				var response BatchShortenResponse
+				err := json.Unmarshal(w.Body.Bytes(), &response)
+				assert.NoError(t, err)
+				assert.Len(t, response.Results, len(tt.expectedErrors))
+
+				for i, result := range response.Results {
+					assert.Equal(t, i, result.Index)
+					assert.Equal(t, tt.expectedErrors[i], result.Error)
+					assert.Equal(t, tt.expectedShorten[i], result.ShortURL != "")
+				}
+			}
+
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestQRCodeHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		shortCode      string
+		query          string
+		mockSetup      func(*MockRepository)
+		expectedStatus int
+		expectedType   string
+	}{
+		{
+			name:      "png by default",
+			shortCode: "abc123",
+			mockSetup: func(m *MockRepository) {
+				m.On("GetLongURLFromShort", mock.Anything, "abc123").
+					Return(&repository.URLs{ShortURL: "abc123", LongURL: "https://example.com"}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedType:   "image/png",
+		},
+		{
+			name:      "svg with high error correction",
+			shortCode: "abc123",
+			query:     "?format=svg&level=H&size=512",
+			mockSetup: func(m *MockRepository) {
+				m.On("GetLongURLFromShort", mock.Anything, "abc123").
+					Return(&repository.URLs{ShortURL: "abc123", LongURL: "https://example.com"}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedType:   "image/svg+xml",
+		},
+		{
+			name:      "unknown short code",
+			shortCode: "notfound",
+			mockSetup: func(m *MockRepository) {
+				m.On("GetLongURLFromShort", mock.Anything, "notfound").
+					Return(nil, repository.ErrURLNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedType:   "application/json",
+		},
+		{
+			name:           "invalid level",
+			shortCode:      "abc123",
+			query:          "?level=X",
+			mockSetup:      func(m *MockRepository) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedType:   "application/json",
+		},
+		{
+			name:           "size out of range",
+			shortCode:      "abc123",
+			query:          "?size=10",
+			mockSetup:      func(m *MockRepository) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedType:   "application/json",
+		},
+		{
+			name:           "unsupported format",
+			shortCode:      "abc123",
+			query:          "?format=gif",
+			mockSetup:      func(m *MockRepository) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedType:   "application/json",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup
+			mockRepo := new(MockRepository)
+			tt.mockSetup(mockRepo)
+
+			cache := cache.NewInMemoryCache(time.Hour)
+			idgenerator := idgenerator.NewMD5Generator(7)
+			api := NewUrlShortenerAPI(mockRepo, "http://localhost:8080", idgenerator, cache)
+
+			req := httptest.NewRequest("GET", "/api/v1/links/"+tt.shortCode+"/qr"+tt.query, nil)
+			w := httptest.NewRecorder()
+
+			router := mux.NewRouter()
+			router.HandleFunc("/api/v1/links/{shortCode}/qr", api.QRCodeHandler)
+			router.ServeHTTP(w, req)
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Equal(t, tt.expectedType, w.Header().Get("Content-Type"))
+
+			switch tt.expectedType {
+			case "image/png":
+				assert.True(t, bytes.HasPrefix(w.Body.Bytes(), []byte("\x89PNG")))
+			case "image/svg+xml":
+				assert.Contains(t, w.Body.String(), `width="512"`)
+			}
+
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestPreviewHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		path           string
+		mockSetup      func(*MockRepository)
+		expectedStatus int
+		expectedBody   []string
+	}{
+		{
+			name: "renders preview without counting a click",
+			path: "/abc123+",
+			mockSetup: func(m *MockRepository) {
+				m.On("GetLongURLFromShort", mock.Anything, "abc123").
+					Return(&repository.URLs{ShortURL: "abc123", LongURL: "https://example.com/?q=<script>"}, nil)
+				m.On("GetStats", mock.Anything, "abc123").
+					Return(&repository.URLs{ShortURL: "abc123", CreatedAt: "2025-01-01T00:00:00Z", Clicks: 7}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody: []string{
+				"http://localhost:8080/abc123",
+				"https://example.com/?q=%3cscript%3e",
+				"2025-01-01T00:00:00Z",
+				"<dd>7</dd>",
+			},
+		},
+		{
+			name: "unknown short code",
+			path: "/notfound+",
+			mockSetup: func(m *MockRepository) {
+				m.On("GetLongURLFromShort", mock.Anything, "notfound").
+					Return(nil, repository.ErrURLNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name: "disabled link",
+			path: "/abc123+",
+			mockSetup: func(m *MockRepository) {
+				m.On("GetLongURLFromShort", mock.Anything, "abc123").
+					Return(&repository.URLs{ShortURL: "abc123", LongURL: "https://example.com", Disabled: true}, nil)
+			},
+			expectedStatus: http.StatusGone,
+			expectedBody:   []string{`{"error":"Short URL has been disabled"}`},
+		},
+		{
+			name: "database error",
+			path: "/abc123+",
+			mockSetup: func(m *MockRepository) {
+				m.On("GetLongURLFromShort", mock.Anything, "abc123").
+					Return(nil, errors.New("connection refused"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   []string{`{"error":"Failed to retrieve URL"}`},
+		},
+		{
+			name: "plain code still redirects",
+			path: "/abc123",
+			mockSetup: func(m *MockRepository) {
+				m.On("GetLongURLFromShort", mock.Anything, "abc123").
+					Return(&repository.URLs{ShortURL: "abc123", LongURL: "https://example.com"}, nil)
+				m.On("IncrementClicks", mock.Anything, "abc123").Return(nil).Maybe()
+			},
+			expectedStatus: http.StatusFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup
+			mockRepo := new(MockRepository)
+			tt.mockSetup(mockRepo)
+
+			cache := cache.NewInMemoryCache(time.Hour)
+			idgenerator := idgenerator.NewMD5Generator(7)
+			api := NewUrlShortenerAPI(mockRepo, "http://localhost:8080", idgenerator, cache)
+
+			req := httptest.NewRequest("GET", tt.path, nil)
+			w := httptest.NewRecorder()
+
+			// same registration order as the server
+			router := mux.NewRouter()
+			router.HandleFunc("/{shortCode}+", api.PreviewHandler)
+			router.HandleFunc("/{shortCode}", api.RedirectHandler)
+			router.ServeHTTP(w, req)
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			for _, want := range tt.expectedBody {
+				assert.Contains(t, w.Body.String(), want)
+			}
+
+			// Allow time for any async increment
+			time.Sleep(10 * time.Millisecond)
+			mockRepo.AssertExpectations(t)
+			if tt.expectedStatus == http.StatusOK {
+				mockRepo.AssertNotCalled(t, "IncrementClicks", mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestAdminCacheHandlers(t *testing.T) {
+	tests := []struct {
+		name           string
+		adminToken     string
+		method         string
+		path           string
+		authorization  string
+		expectedStatus int
+		expectedBody   string
+		expectedSize   int
+	}{
+		{
+			name:           "disabled without a configured token",
+			method:         "GET",
+			path:           "/api/v1/admin/cache",
+			authorization:  "Bearer ",
+			expectedStatus: http.StatusForbidden,
+			expectedSize:   2,
+		},
+		{
+			name:           "missing token",
+			adminToken:     "s3cret",
+			method:         "GET",
+			path:           "/api/v1/admin/cache",
+			expectedStatus: http.StatusUnauthorized,
+			expectedSize:   2,
+		},
+		{
+			name:           "wrong token",
+			adminToken:     "s3cret",
+			method:         "DELETE",
+			path:           "/api/v1/admin/cache",
+			authorization:  "Bearer guess",
+			expectedStatus: http.StatusUnauthorized,
+			expectedSize:   2,
+		},
+		{
+			name:           "stats",
+			adminToken:     "s3cret",
+			method:         "GET",
+			path:           "/api/v1/admin/cache",
+			authorization:  "Bearer s3cret",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"hits":1,"misses":1,"expirations":0,"evictions":0,"size":2}`,
+			expectedSize:   2,
+		},
+		{
+			name:           "cached entry",
+			adminToken:     "s3cret",
+			method:         "GET",
+			path:           "/api/v1/admin/cache/abc123",
+			authorization:  "Bearer s3cret",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"longUrl":"https://example.com"`,
+			expectedSize:   2,
+		},
+		{
+			name:           "negative entry",
+			adminToken:     "s3cret",
+			method:         "GET",
+			path:           "/api/v1/admin/cache/probe123",
+			authorization:  "Bearer s3cret",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"missing":true`,
+			expectedSize:   2,
+		},
+		{
+			name:           "entry not cached",
+			adminToken:     "s3cret",
+			method:         "GET",
+			path:           "/api/v1/admin/cache/unknown1",
+			authorization:  "Bearer s3cret",
+			expectedStatus: http.StatusNotFound,
+			expectedSize:   2,
+		},
+		{
+			name:           "flush",
+			adminToken:     "s3cret",
+			method:         "DELETE",
+			path:           "/api/v1/admin/cache",
+			authorization:  "Bearer s3cret",
+			expectedStatus: http.StatusNoContent,
+			expectedSize:   0,
+		},
+		{
+			name:           "metrics",
+			adminToken:     "s3cret",
+			method:         "GET",
+			path:           "/api/v1/admin/metrics",
+			authorization:  "Bearer s3cret",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"snowflake_clock_rollbacks": `,
+			expectedSize:   2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := cache.NewInMemoryCache(time.Hour)
+			cache.Set("abc123", "https://example.com")
+			cache.SetMissing("probe123", time.Minute)
+			cache.Get("abc123")
+			cache.Get("probe123")
+
+			api := NewUrlShortenerAPI(new(MockRepository), "http://localhost:8080", idgenerator.NewMD5Generator(7), cache,
+				WithAdminToken(tt.adminToken))
+
+			router := mux.NewRouter()
+			router.HandleFunc("/api/v1/admin/cache", api.CacheStatsHandler).Methods("GET")
+			router.HandleFunc("/api/v1/admin/cache", api.FlushCacheHandler).Methods("DELETE")
+			router.HandleFunc("/api/v1/admin/cache/{shortCode}", api.CacheEntryHandler).Methods("GET")
+			router.HandleFunc("/api/v1/admin/metrics", api.MetricsHandler).Methods("GET")
+
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedBody != "" {
+				assert.Contains(t, w.Body.String(), tt.expectedBody)
+			}
+			if tt.expectedStatus == http.StatusUnauthorized {
+				assert.Equal(t, `Bearer realm="admin"`, w.Header().Get("WWW-Authenticate"))
+			}
+			assert.Equal(t, tt.expectedSize, cache.Size())
+		})
+	}
+}
+
+func TestWarmCache(t *testing.T) {
+	expiresAt := time.Now().Add(10 * time.Minute)
+
+	tests := []struct {
+		name          string
+		mockSetup     func(*MockRepository)
+		ctx           func() context.Context
+		expectedCount int
+		expectErr     bool
+		expectCached  []string
+	}{
+		{
+			name: "caches top links",
+			mockSetup: func(m *MockRepository) {
+				m.On("GetTopURLs", mock.Anything, 2).Return([]repository.URLs{
+					{ShortURL: "viral1", LongURL: "https://example.com/viral"},
+					{ShortURL: "abc123", LongURL: "https://example.com", ExpiresAt: &expiresAt},
+				}, nil)
+			},
+			ctx:           context.Background,
+			expectedCount: 2,
+			expectCached:  []string{"viral1", "abc123"},
+		},
+		{
+			name: "repository error",
+			mockSetup: func(m *MockRepository) {
+				m.On("GetTopURLs", mock.Anything, 2).Return(nil, errors.New("database unavailable"))
+			},
+			ctx:       context.Background,
+			expectErr: true,
+		},
+		{
+			name: "stops when the timeout passes",
+			mockSetup: func(m *MockRepository) {
+				m.On("GetTopURLs", mock.Anything, 2).Return([]repository.URLs{
+					{ShortURL: "viral1", LongURL: "https://example.com/viral"},
+				}, nil)
+			},
+			ctx: func() context.Context {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return ctx
+			},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockRepository)
+			tt.mockSetup(mockRepo)
+
+			cache := cache.NewInMemoryCache(time.Hour)
+			api := NewUrlShortenerAPI(mockRepo, "http://localhost:8080", idgenerator.NewMD5Generator(7), cache)
+
+			n, err := api.WarmCache(tt.ctx(), 2)
+			if tt.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.expectedCount, n)
+			assert.Equal(t, len(tt.expectCached), cache.Size())
+			for _, shortCode := range tt.expectCached {
+				_, found := cache.Get(shortCode)
+				assert.True(t, found, shortCode)
+			}
+
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestShortenReverseCache(t *testing.T) {
+	shorten := func(api *UrlShortenerAPI, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		api.ShortenHandler(w, httptest.NewRequest("POST", "/api/v1/shorten", bytes.NewBufferString(body)))
+		return w
+	}
+
+	t.Run("repeat submissions skip the database", func(t *testing.T) {
+		mockRepo := new(MockRepository)
+		mockRepo.On("GetShortURLFromLong", mock.Anything, "https://example.com").
+			Return(nil, repository.ErrURLNotFound).Once()
+		mockRepo.On("SaveUrls", mock.Anything, "new12345", "https://example.com", mock.Anything).
+			Return(nil).Once()
+
+		api := NewUrlShortenerAPI(mockRepo, "http://localhost:8080", &stubGenerator{codes: []string{"new12345"}},
+			cache.NewInMemoryCache(time.Hour), WithReverseCache(cache.NewInMemoryCache(time.Hour)))
+
+		for i := 0; i < 3; i++ {
+			w := shorten(api, `{"longUrl":"https://example.com"}`)
+			assert.Equal(t, http.StatusCreated, w.Code)
+			assert.Contains(t, w.Body.String(), "http://localhost:8080/new12345")
+		}
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("existing link found in the database is cached with its expiry", func(t *testing.T) {
+		expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+		mockRepo := new(MockRepository)
+		mockRepo.On("GetShortURLFromLong", mock.Anything, "https://example.com").
+			Return(&repository.URLs{ShortURL: "abc123", LongURL: "https://example.com", ExpiresAt: &expiresAt}, nil).Once()
+
+		api := NewUrlShortenerAPI(mockRepo, "http://localhost:8080", idgenerator.NewMD5Generator(7),
+			cache.NewInMemoryCache(time.Hour), WithReverseCache(cache.NewInMemoryCache(time.Hour)), WithDefaultTTL(30*time.Minute))
+
+		for i := 0; i < 2; i++ {
+			w := shorten(api, `{"longUrl":"https://example.com"}`)
+			assert.Equal(t, http.StatusCreated, w.Code)
+
+			var response ShortenResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, "http://localhost:8080/abc123", response.ShortURL)
+			require.NotNil(t, response.ExpiresAt)
+			assert.True(t, expiresAt.Equal(*response.ExpiresAt))
+		}
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("request with its own ttl gets its own link", func(t *testing.T) {
+		mockRepo := new(MockRepository)
+		mockRepo.On("GetShortURLFromLong", mock.Anything, "https://example.com").
+			Return(nil, repository.ErrURLNotFound).Once()
+		mockRepo.On("SaveUrls", mock.Anything, "new12345", "https://example.com", mock.Anything).
+			Return(nil).Once()
+		mockRepo.On("GetShortURLFromLong", mock.Anything, "https://example.com").
+			Return(&repository.URLs{ShortURL: "new12345", LongURL: "https://example.com"}, nil).Once()
+		mockRepo.On("SaveUrls", mock.Anything, "ttl12345", "https://example.com",
+			mock.MatchedBy(func(expiresAt *time.Time) bool {
+				return expiresAt != nil && time.Until(*expiresAt) <= time.Hour
+			})).Return(nil).Once()
+
+		api := NewUrlShortenerAPI(mockRepo, "http://localhost:8080", &stubGenerator{codes: []string{"new12345", "ttl12345"}},
+			cache.NewInMemoryCache(time.Hour), WithReverseCache(cache.NewInMemoryCache(time.Hour)))
+
+		w := shorten(api, `{"longUrl":"https://example.com"}`)
+		assert.Contains(t, w.Body.String(), "http://localhost:8080/new12345")
+
+		w = shorten(api, `{"longUrl":"https://example.com","ttl":3600}`)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Contains(t, w.Body.String(), "http://localhost:8080/ttl12345")
+
+		// the short lived link doesn't replace the cached one for default requests
+		w = shorten(api, `{"longUrl":"https://example.com"}`)
+		assert.Contains(t, w.Body.String(), "http://localhost:8080/new12345")
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("default request after a short lived link gets a default link", func(t *testing.T) {
+		mockRepo := new(MockRepository)
+		mockRepo.On("GetShortURLFromLong", mock.Anything, "https://example.com").
+			Return(nil, repository.ErrURLNotFound).Once()
+		mockRepo.On("SaveUrls", mock.Anything, "ttl12345", "https://example.com", mock.Anything).
+			Return(nil).Once()
+		shortLived := time.Now().Add(time.Minute)
+		mockRepo.On("GetShortURLFromLong", mock.Anything, "https://example.com").
+			Return(&repository.URLs{ShortURL: "ttl12345", LongURL: "https://example.com", ExpiresAt: &shortLived}, nil).Once()
+		mockRepo.On("SaveUrls", mock.Anything, "new12345", "https://example.com",
+			mock.MatchedBy(func(expiresAt *time.Time) bool {
+				return expiresAt != nil && time.Until(*expiresAt) > 29*24*time.Hour
+			})).Return(nil).Once()
+
+		reverseCache := cache.NewInMemoryCache(time.Hour)
+		api := NewUrlShortenerAPI(mockRepo, "http://localhost:8080", &stubGenerator{codes: []string{"ttl12345", "new12345"}},
+			cache.NewInMemoryCache(time.Hour), WithReverseCache(reverseCache), WithDefaultTTL(30*24*time.Hour))
+
+		w := shorten(api, `{"longUrl":"https://example.com","ttl":60}`)
+		assert.Contains(t, w.Body.String(), "http://localhost:8080/ttl12345")
+
+		w = shorten(api, `{"longUrl":"https://example.com"}`)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Contains(t, w.Body.String(), "http://localhost:8080/new12345")
+
+		value, found := reverseCache.Get(reverseKey("https://example.com"))
+		require.True(t, found)
+		assert.True(t, strings.HasPrefix(value, "new12345|"))
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("disabling a link invalidates its entry", func(t *testing.T) {
+		mockRepo := new(MockRepository)
+		mockRepo.On("GetShortURLFromLong", mock.Anything, "https://example.com").
+			Return(&repository.URLs{ShortURL: "abc123", LongURL: "https://example.com"}, nil).Once()
+		mockRepo.On("GetStats", mock.Anything, "abc123").
+			Return(&repository.URLs{ShortURL: "abc123", LongURL: "https://example.com"}, nil)
+		mockRepo.On("SetDisabled", mock.Anything, "abc123", true).Return(nil)
+		mockRepo.On("GetShortURLFromLong", mock.Anything, "https://example.com").
+			Return(nil, repository.ErrURLNotFound).Once()
+		mockRepo.On("SaveUrls", mock.Anything, "new12345", "https://example.com", mock.Anything).Return(nil)
+
+		api := NewUrlShortenerAPI(mockRepo, "http://localhost:8080", &stubGenerator{codes: []string{"new12345"}},
+			cache.NewInMemoryCache(time.Hour), WithReverseCache(cache.NewInMemoryCache(time.Hour)), WithAdminToken("s3cret"))
+
+		w := shorten(api, `{"longUrl":"https://example.com"}`)
+		assert.Contains(t, w.Body.String(), "http://localhost:8080/abc123")
+
+		router := mux.NewRouter()
+		router.HandleFunc("/api/v1/links/{shortCode}", api.UpdateLinkHandler).Methods("PATCH")
+		req := httptest.NewRequest("PATCH", "/api/v1/links/abc123", bytes.NewBufferString(`{"disabled":true}`))
+		req.Header.Set("Authorization", "Bearer s3cret")
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		w = shorten(api, `{"longUrl":"https://example.com"}`)
+		assert.Contains(t, w.Body.String(), "http://localhost:8080/new12345")
+		mockRepo.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,21 @@
+package api
+
+import (
+	_ "embed"
+	"log"
+	"net/http"
+)
+
+// OpenAPISpec is the OpenAPI 3 document describing every route the server registers
+//
+//go:embed openapi.json
+var OpenAPISpec []byte
+
+// OpenAPIHandler handles GET requests for the OpenAPI document
+func (api *UrlShortenerAPI) OpenAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(OpenAPISpec); err != nil {
+		log.Printf("Error writing OpenAPI document: %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"context"
+	"html/template"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/oyinetare/url-shortener/repository"
+)
+
+// previewTemplate renders the destination of a short URL instead of redirecting to it
+var previewTemplate = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>Preview of {{.ShortURL}}</title>
+</head>
+<body>
+<h1>Link preview</h1>
+<p><strong>{{.ShortURL}}</strong> redirects to:</p>
+<p><a href="{{.LongURL}}" rel="noopener noreferrer nofollow">{{.LongURL}}</a></p>
+<dl>
+{{- if .CreatedAt}}
+<dt>Created</dt><dd>{{.CreatedAt}}</dd>
+{{- end}}
+<dt>Clicks</dt><dd>{{.Clicks}}</dd>
+</dl>
+</body>
+</html>
+`))
+
+// previewPage holds the values shown on a preview page
+type previewPage struct {
+	ShortURL  string
+	LongURL   string
+	CreatedAt string
+	Clicks    int
+}
+
+// PreviewHandler handles GET requests for /{shortCode}+ by showing where the link goes
+// It uses the same lookup as RedirectHandler but never counts a click
+func (api *UrlShortenerAPI) PreviewHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	shortCode := mux.Vars(r)["shortCode"]
+
+	longURL, err := api.resolveLongURL(ctx, shortCode)
+	if err != nil {
+		if err == repository.ErrURLNotFound {
+			http.NotFound(w, r)
+			return
+		}
+		status, message := api.resolveError(err)
+		api.respondWithError(w, status, message)
+		return
+	}
+
+	page := previewPage{
+		ShortURL: api.shortURL(shortCode),
+		LongURL:  longURL,
+	}
+
+	// creation date and clicks are extras, the preview still renders without them
+	if stats, err := api.repo.GetStats(ctx, shortCode); err == nil {
+		page.CreatedAt = stats.CreatedAt
+		page.Clicks = stats.Clicks
+	} else {
+		log.Printf("Failed to load stats for preview of %s: %v", shortCode, err)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if err := previewTemplate.Execute(w, page); err != nil {
+		log.Printf("Error rendering preview: %v", err)
+	}
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"rsc.io/qr"
+)
+
+// QR code rendering bounds, size is the width of the image in pixels
+const (
+	defaultQRSize = 256
+	minQRSize     = 64
+	maxQRSize     = 2048
+	// quiet zone around the code in modules, as required by the QR spec
+	qrQuietZone = 4
+)
+
+// qrLevels maps the level query parameter to an error-correction level
+var qrLevels = map[string]qr.Level{
+	"L": qr.L,
+	"M": qr.M,
+	"Q": qr.Q,
+	"H": qr.H,
+}
+
+// QRCodeHandler handles GET requests for a QR code of a short URL
+// Query parameters: size (pixels), level (L, M, Q or H) and format (png or svg)
+func (api *UrlShortenerAPI) QRCodeHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	shortCode := mux.Vars(r)["shortCode"]
+	query := r.URL.Query()
+
+	size := defaultQRSize
+	if v := query.Get("size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < minQRSize || n > maxQRSize {
+			api.respondWithError(w, http.StatusBadRequest,
+				fmt.Sprintf("size must be between %d and %d", minQRSize, maxQRSize))
+			return
+		}
+		size = n
+	}
+
+	level := qr.M
+	if v := query.Get("level"); v != "" {
+		l, ok := qrLevels[strings.ToUpper(v)]
+		if !ok {
+			api.respondWithError(w, http.StatusBadRequest, "level must be one of L, M, Q, H")
+			return
+		}
+		level = l
+	}
+
+	format := strings.ToLower(query.Get("format"))
+	if format == "" {
+		format = "png"
+	}
+	if format != "png" && format != "svg" {
+		api.respondWithError(w, http.StatusBadRequest, "format must be png or svg")
+		return
+	}
+
+	// only render codes that actually resolve
+	if _, err := api.resolveLongURL(ctx, shortCode); err != nil {
+		status, message := api.resolveError(err)
+		api.respondWithError(w, status, message)
+		return
+	}
+
+	code, err := qr.Encode(api.shortURL(shortCode), level)
+	if err != nil {
+		log.Printf("Error encoding QR code for %s: %v", shortCode, err)
+		api.respondWithError(w, http.StatusInternalServerError, "Failed to generate QR code")
+		return
+	}
+
+	var body []byte
+	switch format {
+	case "svg":
+		w.Header().Set("Content-Type", "image/svg+xml")
+		body = qrSVG(code, size)
+	default:
+		// PNG can only scale by whole pixels per module, so size is an upper bound
+		code.Scale = size / (code.Size + 2*qrQuietZone)
+		if code.Scale < 1 {
+			code.Scale = 1
+		}
+		w.Header().Set("Content-Type", "image/png")
+		body = code.PNG()
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(body); err != nil {
+		log.Printf("Error writing QR code response: %v", err)
+	}
+}
+
+// qrSVG renders a QR code as an SVG of the given width, one unit square per dark module
+func qrSVG(code *qr.Code, size int) []byte {
+	modules := code.Size + 2*qrQuietZone
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		size, size, modules, modules)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="#fff"/>`, modules, modules)
+	b.WriteString(`<path fill="#000" d="`)
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; x++ {
+			if code.Black(x, y) {
+				fmt.Fprintf(&b, "M%d %dh1v1h-1z", x+qrQuietZone, y+qrQuietZone)
+			}
+		}
+	}
+	b.WriteString(`"/></svg>`)
+
+	return []byte(b.String())
+}
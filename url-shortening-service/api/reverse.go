@@ -0,0 +1,81 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// the reverse cache maps a destination URL to its short code so repeat submissions of popular URLs skip
+// GetShortURLFromLong, whose longUrl(255) prefix index is expensive for long URLs
+// keys are SHA-256 hashes of the URL, bounding key size whatever the URL length
+// values are "shortCode" or "shortCode|expiresAt" (RFC 3339), short codes are base62 so never contain "|"
+
+const reverseEntrySeparator = "|"
+
+// reverseKey returns the reverse cache key of a long URL
+func reverseKey(longURL string) string {
+	sum := sha256.Sum256([]byte(longURL))
+	return hex.EncodeToString(sum[:])
+}
+
+// cachedShortCode looks up the short code already serving longURL in the reverse cache
+func (api *UrlShortenerAPI) cachedShortCode(longURL string) (string, *time.Time, bool) {
+	if api.reverseCache == nil {
+		return "", nil, false
+	}
+
+	value, found := api.reverseCache.Get(reverseKey(longURL))
+	if !found {
+		return "", nil, false
+	}
+
+	shortCode, expiry, hasExpiry := strings.Cut(value, reverseEntrySeparator)
+	if !hasExpiry {
+		return shortCode, nil, true
+	}
+
+	expiresAt, err := time.Parse(time.RFC3339Nano, expiry)
+	if err != nil || !time.Now().Before(expiresAt) {
+		return "", nil, false
+	}
+	return shortCode, &expiresAt, true
+}
+
+// cacheShortCode remembers the short code serving longURL, never past the link's own expiry
+func (api *UrlShortenerAPI) cacheShortCode(longURL, shortCode string, expiresAt *time.Time) {
+	if api.reverseCache == nil {
+		return
+	}
+
+	key := reverseKey(longURL)
+	if expiresAt == nil {
+		api.reverseCache.Set(key, shortCode)
+		return
+	}
+	api.reverseCache.SetWithExpiry(key, shortCode+reverseEntrySeparator+expiresAt.Format(time.RFC3339Nano), *expiresAt)
+}
+
+// currentLongURL returns the destination a short code has before it is updated, disabled or deleted,
+// so its reverse cache entry can be invalidated, empty when there's no reverse cache or the lookup fails
+func (api *UrlShortenerAPI) currentLongURL(ctx context.Context, shortCode string) string {
+	if api.reverseCache == nil {
+		return ""
+	}
+
+	urlData, err := api.repo.GetStats(ctx, shortCode)
+	if err != nil {
+		return ""
+	}
+	return urlData.LongURL
+}
+
+// forgetLongURL drops the reverse cache entry of a long URL
+func (api *UrlShortenerAPI) forgetLongURL(longURL string) {
+	if api.reverseCache == nil || longURL == "" {
+		return
+	}
+	api.reverseCache.Delete(reverseKey(longURL))
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// flightGroup coalesces concurrent lookups of the same key so only one runs at a time,
+// every caller waiting on it shares its result and error
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+// flightCall is a lookup in progress, done is closed once val and err are set
+// forgotten is set under mu when the key is invalidated mid-lookup, so the lookup's result is never cached
+type flightCall struct {
+	done chan struct{}
+	val  string
+	err  error
+
+	mu        sync.Mutex
+	forgotten bool
+}
+
+// do runs fn for key unless a call for key is already in flight, in which case it waits for that call
+// fn runs detached from the caller's cancellation so one caller giving up doesn't fail everyone sharing it,
+// each caller still stops waiting when its own ctx is done
+// fn caches what it finds through store, which skips the write if forget was called for key meanwhile
+func (g *flightGroup) do(ctx context.Context, key string, timeout time.Duration, fn func(ctx context.Context, store func(write func())) (string, error)) (string, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	call, inFlight := g.calls[key]
+	if !inFlight {
+		call = &flightCall{done: make(chan struct{})}
+		g.calls[key] = call
+
+		go func() {
+			fnCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+			defer cancel()
+
+			call.val, call.err = fn(fnCtx, call.store)
+
+			g.mu.Lock()
+			if g.calls[key] == call {
+				delete(g.calls, key)
+			}
+			g.mu.Unlock()
+			close(call.done)
+		}()
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.val, call.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// forget detaches the call in flight for key, if any, so later callers start a fresh lookup and its result isn't cached
+// once forget returns the detached call has either finished writing or never will
+func (g *flightGroup) forget(key string) {
+	g.mu.Lock()
+	call, inFlight := g.calls[key]
+	if inFlight {
+		delete(g.calls, key)
+	}
+	g.mu.Unlock()
+
+	if !inFlight {
+		return
+	}
+
+	call.mu.Lock()
+	call.forgotten = true
+	call.mu.Unlock()
+}
+
+// store runs write unless the call has been forgotten
+func (call *flightCall) store(write func()) {
+	call.mu.Lock()
+	defer call.mu.Unlock()
+
+	if !call.forgotten {
+		write()
+	}
+}
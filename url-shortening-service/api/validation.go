@@ -0,0 +1,128 @@
+package api
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/oyinetare/url-shortener/repository"
+)
+
+// request validation errors
+var (
+	ErrInvalidAlias  = errors.New("invalid custom alias")
+	ErrReservedAlias = errors.New("custom alias is reserved")
+	ErrInvalidExpiry = errors.New("invalid expiry")
+)
+
+// default alias length range, upper bound matches urls.shortUrl VARCHAR(20)
+const (
+	defaultAliasMinLength = 4
+	defaultAliasMaxLength = 20
+)
+
+// maxExpiresAt is the end of the MySQL TIMESTAMP range of urls.expiresAt, later expiries fail the insert
+var maxExpiresAt = time.Date(2038, time.January, 19, 3, 14, 7, 0, time.UTC)
+
+// maxLinkTTL bounds ttl, well short of the ~292 years at which converting it to a time.Duration overflows
+const maxLinkTTL = 10 * 365 * 24 * time.Hour
+
+// defaultReservedCodes are paths the router serves itself, so they can never be short codes
+var defaultReservedCodes = []string{"shorten", "api"}
+
+// validateLongURL checks that a destination is an absolute URL
+func validateLongURL(longUrl string) error {
+	parsedURL, err := url.Parse(longUrl)
+	if err != nil || parsedURL.Scheme == "" || parsedURL.Host == "" {
+		return repository.ErrInvalidURL
+	}
+	return nil
+}
+
+// validateAlias checks a custom alias against the [0-9a-zA-Z] charset,
+// the configured length range and the reserved paths
+func (api *UrlShortenerAPI) validateAlias(alias string) error {
+	if len(alias) < api.aliasMinLength || len(alias) > api.aliasMaxLength {
+		return ErrInvalidAlias
+	}
+
+	for _, c := range alias {
+		if !isBase62(c) {
+			return ErrInvalidAlias
+		}
+	}
+
+	if api.isReservedShortCode(alias) {
+		return ErrReservedAlias
+	}
+
+	return nil
+}
+
+// ReserveShortCodes adds route prefixes that neither aliases nor generated codes may use
+func (api *UrlShortenerAPI) ReserveShortCodes(codes ...string) {
+	for _, code := range codes {
+		api.reservedCodes[strings.ToLower(code)] = true
+	}
+}
+
+// isReservedShortCode reports whether a code collides with a reserved path,
+// compared case-insensitively so "API" can't shadow "/api" on case-folding proxies
+func (api *UrlShortenerAPI) isReservedShortCode(code string) bool {
+	return api.reservedCodes[strings.ToLower(code)]
+}
+
+// resolveExpiry works out when a new link expires from the request or the default link TTL
+func (api *UrlShortenerAPI) resolveExpiry(req ShortenRequest, now time.Time) (*time.Time, error) {
+	if req.ExpiresAt != nil && req.TTL != 0 {
+		return nil, ErrInvalidExpiry
+	}
+
+	if req.ExpiresAt != nil {
+		if !req.ExpiresAt.After(now) || req.ExpiresAt.After(maxExpiresAt) {
+			return nil, ErrInvalidExpiry
+		}
+		return req.ExpiresAt, nil
+	}
+
+	ttl := api.defaultTTL
+	if req.TTL < 0 || req.TTL > int64(maxLinkTTL/time.Second) {
+		return nil, ErrInvalidExpiry
+	}
+	if req.TTL > 0 {
+		ttl = time.Duration(req.TTL) * time.Second
+	}
+
+	// no TTL means the link never expires
+	if ttl == 0 {
+		return nil, nil
+	}
+
+	expiresAt := now.Add(ttl)
+	if expiresAt.After(maxExpiresAt) {
+		return nil, ErrInvalidExpiry
+	}
+	return &expiresAt, nil
+}
+
+// hasExplicitExpiry reports whether the request asks for a lifetime instead of the default link TTL
+func hasExplicitExpiry(req ShortenRequest) bool {
+	return req.ExpiresAt != nil || req.TTL != 0
+}
+
+// canReuseLink reports whether an existing link for the same URL gives the lifetime the request asked for,
+// a request with its own lifetime needs a link expiring exactly then, a default request one lasting at least as long
+func canReuseLink(req ShortenRequest, requested, existing *time.Time) bool {
+	if hasExplicitExpiry(req) {
+		return requested != nil && existing != nil && existing.Equal(*requested)
+	}
+	if existing == nil {
+		return true
+	}
+	return requested != nil && !existing.Before(*requested)
+}
+
+func isBase62(c rune) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
@@ -0,0 +1,24 @@
+package api
+
+import (
+	"context"
+	"fmt"
+)
+
+// WarmCache preloads the cache with up to limit of the most clicked links and returns how many it cached
+// stops early when ctx is done, returning the count cached so far with the context's error
+func (api *UrlShortenerAPI) WarmCache(ctx context.Context, limit int) (int, error) {
+	urls, err := api.repo.GetTopURLs(ctx, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load top URLs: %w", err)
+	}
+
+	for i, url := range urls {
+		if err := ctx.Err(); err != nil {
+			return i, err
+		}
+		api.cacheURL(url.ShortURL, url.LongURL, url.ExpiresAt)
+	}
+
+	return len(urls), nil
+}
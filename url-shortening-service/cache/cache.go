@@ -1,6 +1,10 @@
 package cache
 
 import (
+	"container/list"
+	"context"
+	"errors"
+	"log"
 	"sync"
 	"time"
 )
@@ -10,13 +14,51 @@ var _ CacheInterface = (*InMemoryCache)(nil)
 
 // in-memory caching with cinfigurable ttl eviction strategy
 // deletion happens async with automatic cleanup i.e. a background goroutine that removes expired items periodically
+// optionally bounded by entry count and/or bytes, evicting the least recently used item once a bound is hit
+// negative entries live in their own LRU capped at a tenth of each bound, so a scan of unknown codes can't evict real mappings
 // thread-safe using sync.RWMutex for concurrent access
-// also logs cache hits & misses for monitoring
+// counts hits, misses, expirations & evictions for monitoring, see Stats
+// optionally serves an expired item for a stale window while a background refresh reloads it, see WithStaleWhileRevalidate
+
+// ErrNoLongerValid is returned by a Loader when the short code no longer resolves, dropping the stale item
+var ErrNoLongerValid = errors.New("short code no longer valid")
+
+// Loader reloads the mapping of a short code for a background refresh, expiresAt is the link's own expiry if it has one
+type Loader func(ctx context.Context, shortCode string) (longURL string, expiresAt *time.Time, err error)
+
+// refreshTimeout bounds a single background refresh
+const refreshTimeout = 5 * time.Second
+
+// missingShare is the fraction of each bound negative entries may use, 1/missingShare
+const missingShare = 10
+
+// entryOverhead approximates the per-entry bookkeeping (map slot, list element, CacheItem) in bytes
+const entryOverhead = 128
 
 // CacheItem represents a cached URL mapping
+// Missing marks a negative entry recording that the short code has no mapping
+// LinkExpiresAt is the link's own expiry, never served past even when stale, zero when the link doesn't expire
 type CacheItem struct {
-	LongURL   string
-	ExpiresAt time.Time
+	LongURL       string
+	ExpiresAt     time.Time
+	Missing       bool
+	LinkExpiresAt time.Time
+
+	// position in the LRU list, the negative one for Missing items, nil for items not tracked by it
+	element *list.Element
+	size    int64
+
+	// staleUntil is when a stale item stops being served, zero without stale-while-revalidate
+	staleUntil time.Time
+	refreshing bool
+}
+
+// deadline returns when the item stops being served at all
+func (item *CacheItem) deadline() time.Time {
+	if item.staleUntil.After(item.ExpiresAt) {
+		return item.staleUntil
+	}
+	return item.ExpiresAt
 }
 
 // InMemoryCache provides a simple thread-safe in-memory cache
@@ -24,55 +66,174 @@ type InMemoryCache struct {
 	mu    sync.RWMutex
 	items map[string]*CacheItem
 	ttl   time.Duration
+
+	// lru holds short codes, most recently used at the front
+	lru        *list.List
+	maxEntries int
+	maxBytes   int64
+	bytes      int64
+
+	// missing is the LRU of negative entries, bounded separately from lru
+	missing      *list.List
+	missingBytes int64
+
+	hits        int64
+	misses      int64
+	expirations int64
+	evictions   int64
+
+	// stale-while-revalidate, disabled when loader is nil
+	staleWindow time.Duration
+	loader      Loader
+}
+
+// Option configures optional InMemoryCache behaviour
+type Option func(*InMemoryCache)
+
+// WithMaxEntries bounds the number of cached items, 0 means unbounded
+func WithMaxEntries(n int) Option {
+	return func(c *InMemoryCache) {
+		if n > 0 {
+			c.maxEntries = n
+		}
+	}
+}
+
+// WithMaxBytes bounds the approximate memory used by cached items, 0 means unbounded
+func WithMaxBytes(n int64) Option {
+	return func(c *InMemoryCache) {
+		if n > 0 {
+			c.maxBytes = n
+		}
+	}
+}
+
+// WithStaleWhileRevalidate serves an item for up to window past its TTL while loader refreshes it in the background
+// when the loader fails, e.g. the database is down, the item keeps being served for another window
+func WithStaleWhileRevalidate(window time.Duration, loader Loader) Option {
+	return func(c *InMemoryCache) {
+		if window > 0 && loader != nil {
+			c.staleWindow = window
+			c.loader = loader
+		}
+	}
 }
 
 // NewInMemoryCache creates a new in-memory cache with the given TTL
-func NewInMemoryCache(ttl time.Duration) *InMemoryCache {
+func NewInMemoryCache(ttl time.Duration, opts ...Option) *InMemoryCache {
+	cache := newInMemoryCache(ttl, opts...)
+
+	// start cleanup routine
+	go cache.cleanupExpired()
+
+	return cache
+}
+
+// newInMemoryCache creates a cache without its cleanup goroutine, for callers that schedule cleanup themselves
+func newInMemoryCache(ttl time.Duration, opts ...Option) *InMemoryCache {
 	// default to 1 hour if no TTL provided
 	if ttl <= 0 {
 		ttl = time.Hour
 	}
 
 	cache := &InMemoryCache{
-		items: make(map[string]*CacheItem),
-		ttl:   ttl,
+		items:   make(map[string]*CacheItem),
+		ttl:     ttl,
+		lru:     list.New(),
+		missing: list.New(),
 	}
 
-	// start cleanup routine
-	go cache.cleanupExpired()
+	for _, opt := range opts {
+		opt(cache)
+	}
 
 	return cache
 }
 
 // Get retrieves a long URL from the cache by short code
+// Takes the write lock because a hit moves the item to the front of the LRU list
 func (c *InMemoryCache) Get(shortCode string) (string, bool) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
 	item, exists := c.items[shortCode]
 
-	// doesnt exist
-	if !exists {
+	// doesnt exist or a negative entry
+	if !exists || item.Missing {
+		c.misses++
 		return "", false
 	}
 
+	now := time.Now()
+
 	// cache item expired
-	if time.Now().After(item.ExpiresAt) {
+	if now.After(item.deadline()) {
+		c.remove(shortCode)
+		c.expirations++
+		c.misses++
 		return "", false
 	}
 
+	// stale, serve it while a single background refresh reloads it
+	if now.After(item.ExpiresAt) && !item.refreshing {
+		item.refreshing = true
+		go c.refresh(shortCode, item)
+	}
+
+	if item.element != nil {
+		c.lru.MoveToFront(item.element)
+	}
+
+	c.hits++
 	return item.LongURL, true
 }
 
+// SetMissing stores a negative entry for a short code, replacing any mapping it had
+func (c *InMemoryCache) SetMissing(shortCode string, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	if ttl > c.ttl {
+		ttl = c.ttl
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.store(shortCode, &CacheItem{ExpiresAt: time.Now().Add(ttl), Missing: true})
+}
+
+// IsMissing reports whether the cache holds an unexpired negative entry for a short code
+func (c *InMemoryCache) IsMissing(shortCode string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	item, exists := c.items[shortCode]
+	if !exists || !item.Missing || time.Now().After(item.deadline()) {
+		return false
+	}
+
+	if item.element != nil {
+		c.missingList().MoveToFront(item.element)
+	}
+
+	return true
+}
+
 // Set stores a URL mapping in the cache
 func (c *InMemoryCache) Set(shortCode, longURL string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	c.items[shortCode] = &CacheItem{
-		LongURL:   longURL,
-		ExpiresAt: time.Now().Add(c.ttl),
-	}
+	c.store(shortCode, c.newItem(longURL, time.Time{}))
+}
+
+// SetWithExpiry stores a URL mapping that expires at the earlier of the cache TTL and expiresAt
+func (c *InMemoryCache) SetWithExpiry(shortCode, longURL string, expiresAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.store(shortCode, c.newItem(longURL, expiresAt))
 }
 
 // Delete removes an item from the cache
@@ -80,14 +241,199 @@ func (c *InMemoryCache) Delete(shortCode string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	delete(c.items, shortCode)
+	c.remove(shortCode)
 }
 
 func (c *InMemoryCache) Size() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return len(c.items)
+}
+
+// Stats returns a snapshot of the cache's counters
+func (c *InMemoryCache) Stats() Stats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return Stats{
+		Hits:        c.hits,
+		Misses:      c.misses,
+		Expirations: c.expirations,
+		Evictions:   c.evictions,
+		Size:        len(c.items),
+	}
+}
+
+// Peek returns a copy of the unexpired entry for a short code without touching the LRU order or counters
+func (c *InMemoryCache) Peek(shortCode string) (CacheItem, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	item, exists := c.items[shortCode]
+	if !exists || time.Now().After(item.deadline()) {
+		return CacheItem{}, false
+	}
+
+	return CacheItem{LongURL: item.LongURL, ExpiresAt: item.ExpiresAt, Missing: item.Missing, LinkExpiresAt: item.LinkExpiresAt}, true
+}
+
+// Flush removes every item, counters are kept
+func (c *InMemoryCache) Flush() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	return len(c.items)
+	c.items = make(map[string]*CacheItem)
+	c.lruList().Init()
+	c.missingList().Init()
+	c.bytes = 0
+	c.missingBytes = 0
+}
+
+// newItem builds a mapping that expires at the earlier of the cache TTL and linkExpiresAt, zero meaning no link expiry
+func (c *InMemoryCache) newItem(longURL string, linkExpiresAt time.Time) *CacheItem {
+	item := &CacheItem{
+		LongURL:       longURL,
+		ExpiresAt:     time.Now().Add(c.ttl),
+		LinkExpiresAt: linkExpiresAt,
+	}
+	if !linkExpiresAt.IsZero() && linkExpiresAt.Before(item.ExpiresAt) {
+		item.ExpiresAt = linkExpiresAt
+	}
+
+	if c.loader != nil {
+		item.staleUntil = c.staleDeadline(item, item.ExpiresAt)
+	}
+
+	return item
+}
+
+// staleDeadline returns when an item stale from "from" stops being served, never past the link's own expiry
+func (c *InMemoryCache) staleDeadline(item *CacheItem, from time.Time) time.Time {
+	staleUntil := from.Add(c.staleWindow)
+	if !item.LinkExpiresAt.IsZero() && item.LinkExpiresAt.Before(staleUntil) {
+		staleUntil = item.LinkExpiresAt
+	}
+	return staleUntil
+}
+
+// refresh reloads a stale item, leaving the cache alone if the item was replaced or removed meanwhile
+func (c *InMemoryCache) refresh(shortCode string, item *CacheItem) {
+	ctx, cancel := context.WithTimeout(context.Background(), refreshTimeout)
+	defer cancel()
+
+	longURL, expiresAt, err := c.loader(ctx, shortCode)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.items[shortCode] != item {
+		return
+	}
+
+	switch {
+	case err == nil:
+		var linkExpiresAt time.Time
+		if expiresAt != nil {
+			linkExpiresAt = *expiresAt
+		}
+		c.store(shortCode, c.newItem(longURL, linkExpiresAt))
+	case errors.Is(err, ErrNoLongerValid):
+		c.remove(shortCode)
+	default:
+		// source unavailable, keep serving stale and retry on a later Get
+		log.Printf("Failed to refresh cached short code %s: %v", shortCode, err)
+		item.staleUntil = c.staleDeadline(item, time.Now())
+		item.refreshing = false
+	}
+}
+
+// store inserts or replaces an item and evicts until the cache is back within its bounds, callers must hold c.mu
+func (c *InMemoryCache) store(shortCode string, item *CacheItem) {
+	c.remove(shortCode)
+
+	item.size = int64(len(shortCode)+len(item.LongURL)) + entryOverhead
+	item.element = c.listOf(item).PushFront(shortCode)
+	c.items[shortCode] = item
+	if item.Missing {
+		c.missingBytes += item.size
+	} else {
+		c.bytes += item.size
+	}
+
+	c.evict()
+}
+
+// remove deletes an item and its LRU bookkeeping, callers must hold c.mu
+func (c *InMemoryCache) remove(shortCode string) {
+	item, exists := c.items[shortCode]
+	if !exists {
+		return
+	}
+
+	if item.element != nil {
+		c.listOf(item).Remove(item.element)
+	}
+	if item.Missing {
+		c.missingBytes -= item.size
+	} else {
+		c.bytes -= item.size
+	}
+	delete(c.items, shortCode)
+}
+
+// evict drops least recently used items while either LRU is over its bounds, callers must hold c.mu
+func (c *InMemoryCache) evict() {
+	c.evictFrom(c.lruList(), c.overLimit)
+	c.evictFrom(c.missingList(), c.missingOverLimit)
+}
+
+// evictFrom drops the least recently used items of lru while overLimit, callers must hold c.mu
+func (c *InMemoryCache) evictFrom(lru *list.List, overLimit func() bool) {
+	for overLimit() {
+		oldest := lru.Back()
+		if oldest == nil {
+			return
+		}
+		c.remove(oldest.Value.(string))
+		c.evictions++
+	}
+}
+
+func (c *InMemoryCache) overLimit() bool {
+	return (c.maxEntries > 0 && c.lruList().Len() > c.maxEntries) ||
+		(c.maxBytes > 0 && c.bytes > c.maxBytes)
+}
+
+// missingOverLimit reports whether negative entries use more than their share of either bound, at least one is kept
+func (c *InMemoryCache) missingOverLimit() bool {
+	n := c.missingList().Len()
+	return n > 1 && ((c.maxEntries > 0 && n > c.maxEntries/missingShare) ||
+		(c.maxBytes > 0 && c.missingBytes > c.maxBytes/missingShare))
+}
+
+// lruList returns the LRU list, creating it for caches built without NewInMemoryCache
+func (c *InMemoryCache) lruList() *list.List {
+	if c.lru == nil {
+		c.lru = list.New()
+	}
+	return c.lru
+}
+
+// missingList returns the LRU list of negative entries, creating it for caches built without NewInMemoryCache
+func (c *InMemoryCache) missingList() *list.List {
+	if c.missing == nil {
+		c.missing = list.New()
+	}
+	return c.missing
+}
+
+// listOf returns the LRU list tracking an item
+func (c *InMemoryCache) listOf(item *CacheItem) *list.List {
+	if item.Missing {
+		return c.missingList()
+	}
+	return c.lruList()
 }
 
 func (c *InMemoryCache) cleanup() {
@@ -96,9 +442,10 @@ func (c *InMemoryCache) cleanup() {
 
 	for key, item := range c.items {
 		now := time.Now()
-		if now.After(item.ExpiresAt) {
+		if now.After(item.deadline()) {
 
-			delete(c.items, key)
+			c.remove(key)
+			c.expirations++
 		}
 	}
 }
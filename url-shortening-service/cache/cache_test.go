@@ -1,6 +1,10 @@
 package cache
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -130,3 +134,331 @@ func TestCleanup(t *testing.T) {
 	_, found = cache.Get("expired2")
 	assert.False(t, found)
 }
+
+func TestSetWithExpiry(t *testing.T) {
+	cache := NewInMemoryCache(1 * time.Hour)
+
+	// link expiry earlier than cache TTL wins
+	linkExpiry := time.Now().Add(10 * time.Minute)
+	cache.SetWithExpiry("short", "https://example.com", linkExpiry)
+	assert.Equal(t, linkExpiry, cache.items["short"].ExpiresAt)
+
+	// cache TTL earlier than link expiry wins
+	cache.SetWithExpiry("long", "https://example.com", time.Now().Add(24*time.Hour))
+	assert.True(t, cache.items["long"].ExpiresAt.Before(time.Now().Add(time.Hour+time.Second)))
+
+	// already expired link is never served
+	cache.SetWithExpiry("gone", "https://example.com", time.Now().Add(-time.Minute))
+	_, found := cache.Get("gone")
+	assert.False(t, found)
+}
+
+func TestLRUEviction(t *testing.T) {
+	tests := []struct {
+		name              string
+		opts              []Option
+		setup             func(c *InMemoryCache)
+		expectedPresent   []string
+		expectedAbsent    []string
+		expectedEvictions int64
+	}{
+		{
+			name: "evicts least recently set item past max entries",
+			opts: []Option{WithMaxEntries(2)},
+			setup: func(c *InMemoryCache) {
+				c.Set("a", "https://a.com")
+				c.Set("b", "https://b.com")
+				c.Set("c", "https://c.com")
+			},
+			expectedPresent:   []string{"b", "c"},
+			expectedAbsent:    []string{"a"},
+			expectedEvictions: 1,
+		},
+		{
+			name: "get refreshes recency",
+			opts: []Option{WithMaxEntries(2)},
+			setup: func(c *InMemoryCache) {
+				c.Set("a", "https://a.com")
+				c.Set("b", "https://b.com")
+				c.Get("a")
+				c.Set("c", "https://c.com")
+			},
+			expectedPresent:   []string{"a", "c"},
+			expectedAbsent:    []string{"b"},
+			expectedEvictions: 1,
+		},
+		{
+			name: "overwriting a key does not evict",
+			opts: []Option{WithMaxEntries(2)},
+			setup: func(c *InMemoryCache) {
+				c.Set("a", "https://a.com")
+				c.Set("b", "https://b.com")
+				c.Set("a", "https://a2.com")
+			},
+			expectedPresent:   []string{"a", "b"},
+			expectedEvictions: 0,
+		},
+		{
+			name: "evicts past max bytes",
+			// room for two small entries but not three
+			opts: []Option{WithMaxBytes(2*entryOverhead + 40)},
+			setup: func(c *InMemoryCache) {
+				c.Set("a", "https://a.com")
+				c.Set("b", "https://b.com")
+				c.Set("c", "https://c.com")
+			},
+			expectedPresent:   []string{"b", "c"},
+			expectedAbsent:    []string{"a"},
+			expectedEvictions: 1,
+		},
+		{
+			name: "delete frees room",
+			opts: []Option{WithMaxEntries(2)},
+			setup: func(c *InMemoryCache) {
+				c.Set("a", "https://a.com")
+				c.Set("b", "https://b.com")
+				c.Delete("a")
+				c.Set("c", "https://c.com")
+			},
+			expectedPresent:   []string{"b", "c"},
+			expectedAbsent:    []string{"a"},
+			expectedEvictions: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := NewInMemoryCache(time.Hour, tt.opts...)
+			tt.setup(cache)
+
+			for _, key := range tt.expectedPresent {
+				_, found := cache.Get(key)
+				assert.True(t, found, key)
+			}
+			for _, key := range tt.expectedAbsent {
+				_, found := cache.Get(key)
+				assert.False(t, found, key)
+			}
+			assert.Equal(t, tt.expectedEvictions, cache.Stats().Evictions)
+			assert.Equal(t, len(tt.expectedPresent), cache.Size())
+		})
+	}
+}
+
+func TestNegativeEntries(t *testing.T) {
+	tests := []struct {
+		name          string
+		setup         func(c *InMemoryCache)
+		expectMissing bool
+		expectFound   bool
+	}{
+		{
+			name:          "set missing marks code as missing",
+			setup:         func(c *InMemoryCache) { c.SetMissing("qwerty", time.Minute) },
+			expectMissing: true,
+		},
+		{
+			name: "set clears negative entry",
+			setup: func(c *InMemoryCache) {
+				c.SetMissing("qwerty", time.Minute)
+				c.Set("qwerty", "https://example.com")
+			},
+			expectFound: true,
+		},
+		{
+			name: "delete clears negative entry",
+			setup: func(c *InMemoryCache) {
+				c.SetMissing("qwerty", time.Minute)
+				c.Delete("qwerty")
+			},
+		},
+		{
+			name: "negative entry expires",
+			setup: func(c *InMemoryCache) {
+				c.SetMissing("qwerty", time.Millisecond)
+				time.Sleep(5 * time.Millisecond)
+			},
+		},
+		{
+			name:  "zero ttl stores nothing",
+			setup: func(c *InMemoryCache) { c.SetMissing("qwerty", 0) },
+		},
+		{
+			name:        "mapping is not missing",
+			setup:       func(c *InMemoryCache) { c.Set("qwerty", "https://example.com") },
+			expectFound: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := NewInMemoryCache(time.Hour)
+			tt.setup(cache)
+
+			assert.Equal(t, tt.expectMissing, cache.IsMissing("qwerty"))
+			_, found := cache.Get("qwerty")
+			assert.Equal(t, tt.expectFound, found)
+		})
+	}
+}
+
+func TestNegativeEntriesKeepToTheirShare(t *testing.T) {
+	cache := NewInMemoryCache(time.Hour, WithMaxEntries(20))
+	for i := 0; i < 20; i++ {
+		cache.Set(fmt.Sprintf("hot%d", i), "https://example.com")
+	}
+
+	// a scan of unknown codes only churns the negative entries
+	for i := 0; i < 1000; i++ {
+		code := fmt.Sprintf("probe%d", i)
+		cache.SetMissing(code, time.Minute)
+		assert.True(t, cache.IsMissing(code))
+	}
+
+	for i := 0; i < 20; i++ {
+		_, found := cache.Get(fmt.Sprintf("hot%d", i))
+		assert.True(t, found)
+	}
+	assert.Equal(t, 22, cache.Size())
+	assert.True(t, cache.IsMissing("probe999"))
+	assert.False(t, cache.IsMissing("probe0"))
+}
+
+func TestStats(t *testing.T) {
+	cache := NewInMemoryCache(time.Hour)
+
+	cache.Set("qwerty", "https://example.com")
+	cache.SetWithExpiry("stale", "https://stale.com", time.Now().Add(-time.Minute))
+	cache.SetMissing("probe", time.Minute)
+
+	cache.Get("qwerty")  // hit
+	cache.Get("qwerty")  // hit
+	cache.Get("unknown") // miss
+	cache.Get("probe")   // negative entry counts as a miss
+	cache.Get("stale")   // expired, a miss and an expiration
+
+	assert.Equal(t, Stats{Hits: 2, Misses: 3, Expirations: 1, Size: 2}, cache.Stats())
+
+	// an expired item is counted once, whether Get or cleanup finds it
+	cache.SetWithExpiry("soon", "https://soon.com", time.Now().Add(time.Millisecond))
+	time.Sleep(5 * time.Millisecond)
+	cache.Get("soon")
+	cache.cleanup()
+	assert.Equal(t, int64(2), cache.Stats().Expirations)
+}
+
+func TestPeekAndFlush(t *testing.T) {
+	cache := NewInMemoryCache(time.Hour)
+	expiresAt := time.Now().Add(10 * time.Minute)
+
+	cache.SetWithExpiry("qwerty", "https://example.com", expiresAt)
+	cache.SetMissing("probe", time.Minute)
+
+	item, found := cache.Peek("qwerty")
+	assert.True(t, found)
+	assert.Equal(t, "https://example.com", item.LongURL)
+	assert.Equal(t, expiresAt, item.ExpiresAt)
+	assert.False(t, item.Missing)
+
+	item, found = cache.Peek("probe")
+	assert.True(t, found)
+	assert.True(t, item.Missing)
+
+	_, found = cache.Peek("unknown")
+	assert.False(t, found)
+
+	// peeking doesn't count towards the stats
+	assert.Equal(t, Stats{Size: 2}, cache.Stats())
+
+	cache.Flush()
+	assert.Equal(t, 0, cache.Size())
+	_, found = cache.Get("qwerty")
+	assert.False(t, found)
+
+	// still usable after a flush
+	cache.Set("qwerty", "https://example.com")
+	_, found = cache.Get("qwerty")
+	assert.True(t, found)
+}
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	// a loader answering with the given result and counting its calls
+	loaderFor := func(longURL string, err error) (Loader, *atomic.Int32) {
+		calls := new(atomic.Int32)
+		return func(ctx context.Context, shortCode string) (string, *time.Time, error) {
+			calls.Add(1)
+			return longURL, nil, err
+		}, calls
+	}
+
+	t.Run("serves stale while refreshing", func(t *testing.T) {
+		loader, calls := loaderFor("https://new.example.com", nil)
+		cache := NewInMemoryCache(20*time.Millisecond, WithStaleWhileRevalidate(time.Minute, loader))
+		cache.Set("qwerty", "https://example.com")
+		time.Sleep(30 * time.Millisecond)
+
+		longURL, found := cache.Get("qwerty")
+		assert.True(t, found)
+		assert.Equal(t, "https://example.com", longURL)
+
+		assert.Eventually(t, func() bool {
+			longURL, _ := cache.Get("qwerty")
+			return longURL == "https://new.example.com"
+		}, time.Second, time.Millisecond)
+		assert.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("keeps serving stale while the source is down", func(t *testing.T) {
+		loader, calls := loaderFor("", errors.New("database unavailable"))
+		cache := NewInMemoryCache(20*time.Millisecond, WithStaleWhileRevalidate(100*time.Millisecond, loader))
+		cache.Set("qwerty", "https://example.com")
+
+		// first served stale once the original window is mostly used up
+		time.Sleep(80 * time.Millisecond)
+		_, found := cache.Get("qwerty")
+		assert.True(t, found)
+		assert.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, time.Millisecond)
+
+		// past the original window of 120ms, the failed refresh extended it
+		time.Sleep(70 * time.Millisecond)
+		longURL, found := cache.Get("qwerty")
+		assert.True(t, found)
+		assert.Equal(t, "https://example.com", longURL)
+		assert.Eventually(t, func() bool { return calls.Load() == 2 }, time.Second, time.Millisecond)
+	})
+
+	t.Run("drops links that no longer resolve", func(t *testing.T) {
+		loader, _ := loaderFor("", ErrNoLongerValid)
+		cache := NewInMemoryCache(20*time.Millisecond, WithStaleWhileRevalidate(time.Minute, loader))
+		cache.Set("qwerty", "https://example.com")
+		time.Sleep(30 * time.Millisecond)
+
+		_, found := cache.Get("qwerty")
+		assert.True(t, found)
+
+		assert.Eventually(t, func() bool {
+			_, found := cache.Get("qwerty")
+			return !found
+		}, time.Second, time.Millisecond)
+	})
+
+	t.Run("never serves past the link expiry", func(t *testing.T) {
+		loader, calls := loaderFor("https://example.com", nil)
+		cache := NewInMemoryCache(time.Hour, WithStaleWhileRevalidate(time.Minute, loader))
+		cache.SetWithExpiry("qwerty", "https://example.com", time.Now().Add(20*time.Millisecond))
+		time.Sleep(30 * time.Millisecond)
+
+		_, found := cache.Get("qwerty")
+		assert.False(t, found)
+		assert.Equal(t, int32(0), calls.Load())
+	})
+
+	t.Run("disabled without a loader", func(t *testing.T) {
+		cache := NewInMemoryCache(20*time.Millisecond, WithStaleWhileRevalidate(time.Minute, nil))
+		cache.Set("qwerty", "https://example.com")
+		time.Sleep(30 * time.Millisecond)
+
+		_, found := cache.Get("qwerty")
+		assert.False(t, found)
+	})
+}
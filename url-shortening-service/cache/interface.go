@@ -1,8 +1,32 @@
 package cache
 
+import "time"
+
 type CacheInterface interface {
 	Get(shortCode string) (string, bool)
 	Set(shortCode, longUrl string)
+	// SetWithExpiry stores a mapping that must not outlive expiresAt, even if the cache TTL is longer
+	SetWithExpiry(shortCode, longUrl string, expiresAt time.Time)
 	Delete(shortCode string)
+	// SetMissing remembers for at most ttl that shortCode has no mapping, Set and Delete clear it
+	SetMissing(shortCode string, ttl time.Duration)
+	// IsMissing reports whether shortCode was recently remembered as having no mapping
+	IsMissing(shortCode string) bool
 	Size() int
+	// Stats returns a snapshot of the cache's counters
+	Stats() Stats
+	// Peek returns the entry for shortCode, negative entries included, without counting a hit or miss
+	Peek(shortCode string) (CacheItem, bool)
+	// Flush removes every entry
+	Flush()
+}
+
+// Stats is a point-in-time snapshot of cache counters
+// Expirations counts entries dropped because their TTL passed, Evictions those dropped to stay within size bounds
+type Stats struct {
+	Hits        int64 `json:"hits"`
+	Misses      int64 `json:"misses"`
+	Expirations int64 `json:"expirations"`
+	Evictions   int64 `json:"evictions"`
+	Size        int   `json:"size"`
 }
@@ -0,0 +1,448 @@
+package cache
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Compile-time check that RedisCache implements Cache interface
+var _ CacheInterface = (*RedisCache)(nil)
+
+// Redis-backed cache shared by every replica, so an update or delete on one pod is seen by all of them
+// speaks the RESP protocol (https://redis.io/docs/reference/protocol-spec/) directly over a small connection pool
+// CacheInterface has no error returns, so Redis failures are logged and treated as cache misses
+
+const (
+	// redisKeyPrefix namespaces short code keys unless WithRedisKeyPrefix replaces it
+	redisKeyPrefix   = "url:"
+	redisPoolSize    = 10
+	redisDialTimeout = 2 * time.Second
+	redisIOTimeout   = time.Second
+)
+
+// redisMissingValue marks a negative entry, stored under the same key as the mapping so SET and DEL replace it
+const redisMissingValue = ""
+
+// redisExpirySeparator follows the long URL in a value set with SetWithExpiry, then the link's expiry in unix ms,
+// a tab as url.Parse rejects control characters so no long URL contains one
+const redisExpirySeparator = "\t"
+
+// errRedisNil is returned for a RESP null reply, e.g. GET on a missing key
+var errRedisNil = errors.New("redis: nil")
+
+// RedisCache stores URL mappings in Redis with a per-key TTL
+type RedisCache struct {
+	addr     string
+	password string
+	db       int
+	ttl      time.Duration
+	prefix   string
+
+	// sem bounds the connections in use, idle holds ones ready for reuse
+	sem  chan struct{}
+	idle chan *redisConn
+
+	// hits and misses as seen by this replica, expirations and evictions come from the server
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// redisConn is one connection with its buffered reader
+type redisConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// RedisOption configures a RedisCache
+type RedisOption func(*RedisCache)
+
+// WithRedisKeyPrefix namespaces keys with prefix instead of "url:", for a second cache sharing the server
+func WithRedisKeyPrefix(prefix string) RedisOption {
+	return func(c *RedisCache) {
+		c.prefix = prefix
+	}
+}
+
+// NewRedisCache creates a cache backed by the Redis server at addr
+// Connections are dialled lazily, use Ping to check the server is reachable
+func NewRedisCache(addr, password string, db int, ttl time.Duration, opts ...RedisOption) *RedisCache {
+	// default to 1 hour if no TTL provided
+	if ttl <= 0 {
+		ttl = time.Hour
+	}
+
+	c := &RedisCache{
+		addr:     addr,
+		password: password,
+		db:       db,
+		ttl:      ttl,
+		prefix:   redisKeyPrefix,
+		sem:      make(chan struct{}, redisPoolSize),
+		idle:     make(chan *redisConn, redisPoolSize),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Ping checks that the Redis server is reachable and accepts our credentials
+func (c *RedisCache) Ping() error {
+	_, err := c.do("PING")
+	return err
+}
+
+// Get retrieves a long URL from Redis by short code
+func (c *RedisCache) Get(shortCode string) (string, bool) {
+	reply, err := c.do("GET", c.key(shortCode))
+	if err != nil {
+		if err != errRedisNil {
+			log.Printf("Redis GET failed for %s: %v", shortCode, err)
+		}
+		c.misses.Add(1)
+		return "", false
+	}
+
+	value, ok := reply.(string)
+	if !ok || value == redisMissingValue {
+		c.misses.Add(1)
+		return "", false
+	}
+
+	longURL, _ := decodeRedisValue(value)
+	c.hits.Add(1)
+	return longURL, true
+}
+
+// SetMissing stores a negative entry for a short code, replacing any mapping it had
+func (c *RedisCache) SetMissing(shortCode string, ttl time.Duration) {
+	if ttl > c.ttl {
+		ttl = c.ttl
+	}
+	if ttl < time.Millisecond {
+		return
+	}
+
+	c.setPX(shortCode, redisMissingValue, ttl)
+}
+
+// IsMissing reports whether Redis holds a negative entry for a short code
+func (c *RedisCache) IsMissing(shortCode string) bool {
+	reply, err := c.do("GET", c.key(shortCode))
+	if err != nil {
+		if err != errRedisNil {
+			log.Printf("Redis GET failed for %s: %v", shortCode, err)
+		}
+		return false
+	}
+
+	value, ok := reply.(string)
+	return ok && value == redisMissingValue
+}
+
+// Set stores a URL mapping in Redis with the cache TTL
+func (c *RedisCache) Set(shortCode, longURL string) {
+	c.setPX(shortCode, longURL, c.ttl)
+}
+
+// SetWithExpiry stores a URL mapping that expires at the earlier of the cache TTL and expiresAt
+func (c *RedisCache) SetWithExpiry(shortCode, longURL string, expiresAt time.Time) {
+	ttl := time.Until(expiresAt)
+	if ttl > c.ttl {
+		ttl = c.ttl
+	}
+
+	// already expired, make sure no stale copy is left behind
+	if ttl < time.Millisecond {
+		c.Delete(shortCode)
+		return
+	}
+
+	// the link's expiry goes along, so a tier promoting the entry can keep it rather than the key's TTL
+	c.setPX(shortCode, longURL+redisExpirySeparator+strconv.FormatInt(expiresAt.UnixMilli(), 10), ttl)
+}
+
+// Delete removes a mapping from Redis
+func (c *RedisCache) Delete(shortCode string) {
+	if _, err := c.do("DEL", c.key(shortCode)); err != nil {
+		log.Printf("Redis DEL failed for %s: %v", shortCode, err)
+	}
+}
+
+// Size returns the number of keys in the Redis database
+// counts every key in the selected db, so use a dedicated db for the cache
+func (c *RedisCache) Size() int {
+	reply, err := c.do("DBSIZE")
+	if err != nil {
+		log.Printf("Redis DBSIZE failed: %v", err)
+		return 0
+	}
+
+	n, _ := reply.(int64)
+	return int(n)
+}
+
+// Stats returns this replica's hits and misses alongside the server's expired_keys and evicted_keys counters
+func (c *RedisCache) Stats() Stats {
+	stats := Stats{
+		Hits:   c.hits.Load(),
+		Misses: c.misses.Load(),
+		Size:   c.Size(),
+	}
+
+	reply, err := c.do("INFO", "stats")
+	if err != nil {
+		log.Printf("Redis INFO failed: %v", err)
+		return stats
+	}
+
+	info, _ := reply.(string)
+	for _, line := range strings.Split(info, "\r\n") {
+		name, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		n, _ := strconv.ParseInt(value, 10, 64)
+		switch name {
+		case "expired_keys":
+			stats.Expirations = n
+		case "evicted_keys":
+			stats.Evictions = n
+		}
+	}
+
+	return stats
+}
+
+// Peek returns the entry for a short code and when Redis will expire it, without counting a hit or miss
+func (c *RedisCache) Peek(shortCode string) (CacheItem, bool) {
+	key := c.key(shortCode)
+
+	reply, err := c.do("GET", key)
+	if err != nil {
+		if err != errRedisNil {
+			log.Printf("Redis GET failed for %s: %v", shortCode, err)
+		}
+		return CacheItem{}, false
+	}
+	value, _ := reply.(string)
+
+	// PTTL is negative when the key has just expired or has no TTL, which Set never leaves
+	reply, err = c.do("PTTL", key)
+	if err != nil {
+		log.Printf("Redis PTTL failed for %s: %v", shortCode, err)
+		return CacheItem{}, false
+	}
+	ms, _ := reply.(int64)
+	if ms < 0 {
+		return CacheItem{}, false
+	}
+
+	longURL, linkExpiresAt := decodeRedisValue(value)
+	return CacheItem{
+		LongURL:       longURL,
+		ExpiresAt:     time.Now().Add(time.Duration(ms) * time.Millisecond),
+		Missing:       value == redisMissingValue,
+		LinkExpiresAt: linkExpiresAt,
+	}, true
+}
+
+// decodeRedisValue splits a stored value into the long URL and the link's expiry, zero when it has none
+func decodeRedisValue(value string) (string, time.Time) {
+	longURL, expiry, found := strings.Cut(value, redisExpirySeparator)
+	if !found {
+		return value, time.Time{}
+	}
+
+	ms, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil {
+		return longURL, time.Time{}
+	}
+	return longURL, time.UnixMilli(ms)
+}
+
+// Flush removes every key in the Redis database
+// like Size this covers the whole selected db, so use a dedicated db for the cache
+func (c *RedisCache) Flush() {
+	if _, err := c.do("FLUSHDB"); err != nil {
+		log.Printf("Redis FLUSHDB failed: %v", err)
+	}
+}
+
+// key returns the Redis key of a short code
+func (c *RedisCache) key(shortCode string) string {
+	return c.prefix + shortCode
+}
+
+func (c *RedisCache) setPX(shortCode, longURL string, ttl time.Duration) {
+	px := strconv.FormatInt(ttl.Milliseconds(), 10)
+	if _, err := c.do("SET", c.key(shortCode), longURL, "PX", px); err != nil {
+		log.Printf("Redis SET failed for %s: %v", shortCode, err)
+	}
+}
+
+// do runs one command on a pooled connection and returns its decoded reply
+// replies decode to string, int64, []interface{} or errRedisNil
+func (c *RedisCache) do(args ...string) (interface{}, error) {
+	c.sem <- struct{}{}
+	defer func() { <-c.sem }()
+
+	var rc *redisConn
+	pooled := true
+	select {
+	case rc = <-c.idle:
+	default:
+		var err error
+		if rc, err = c.dial(); err != nil {
+			return nil, err
+		}
+		pooled = false
+	}
+
+	reply, err := rc.do(args...)
+
+	// the server may have closed an idle connection (restart, idle timeout), retry once on a fresh one
+	// rather than lose the command, which for DEL would leave every replica serving a stale entry
+	if isConnError(err) && pooled {
+		rc.conn.Close()
+		if rc, err = c.dial(); err != nil {
+			return nil, err
+		}
+		reply, err = rc.do(args...)
+	}
+
+	if isConnError(err) {
+		rc.conn.Close()
+		return nil, err
+	}
+	c.idle <- rc
+
+	return reply, err
+}
+
+// isConnError reports whether err leaves the connection unusable,
+// a server error reply doesn't, anything else (timeouts, EOF) does
+func isConnError(err error) bool {
+	var serverErr redisError
+	return err != nil && err != errRedisNil && !errors.As(err, &serverErr)
+}
+
+// dial opens a connection, authenticating and selecting the db when configured
+func (c *RedisCache) dial() (*redisConn, error) {
+	conn, err := net.DialTimeout("tcp", c.addr, redisDialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+
+	rc := &redisConn{conn: conn, reader: bufio.NewReader(conn)}
+
+	if c.password != "" {
+		if _, err := rc.do("AUTH", c.password); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to authenticate with redis: %w", err)
+		}
+	}
+
+	if c.db != 0 {
+		if _, err := rc.do("SELECT", strconv.Itoa(c.db)); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to select redis db %d: %w", c.db, err)
+		}
+	}
+
+	return rc, nil
+}
+
+// redisError is an error reply sent by the server
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// do writes a command as a RESP array of bulk strings and reads the reply
+func (rc *redisConn) do(args ...string) (interface{}, error) {
+	if err := rc.conn.SetDeadline(time.Now().Add(redisIOTimeout)); err != nil {
+		return nil, err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+
+	if _, err := rc.conn.Write([]byte(b.String())); err != nil {
+		return nil, err
+	}
+
+	return readRESP(rc.reader)
+}
+
+// readRESP decodes one RESP reply
+func readRESP(r *bufio.Reader) (interface{}, error) {
+	line, err := readRESPLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid bulk length %q", line)
+		}
+		if n < 0 {
+			return nil, errRedisNil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid array length %q", line)
+		}
+		if n < 0 {
+			return nil, errRedisNil
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			item, err := readRESP(r)
+			if err != nil && err != errRedisNil {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply %q", line)
+	}
+}
+
+// readRESPLine reads up to CRLF and strips it
+func readRESPLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(line, "\r\n"), nil
+}
@@ -0,0 +1,419 @@
+package cache
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRedis is an in-process stand-in that speaks enough RESP for RedisCache
+type fakeRedis struct {
+	listener net.Listener
+	password string
+
+	mu       sync.Mutex
+	dbs      map[int]map[string]fakeRedisValue
+	commands []string
+	conns    map[net.Conn]bool
+}
+
+type fakeRedisValue struct {
+	value     string
+	expiresAt time.Time
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	f := &fakeRedis{
+		listener: listener,
+		password: password,
+		dbs:      make(map[int]map[string]fakeRedisValue),
+		conns:    make(map[net.Conn]bool),
+	}
+	go f.serve()
+	t.Cleanup(func() { listener.Close() })
+
+	return f
+}
+
+func (f *fakeRedis) addr() string {
+	return f.listener.Addr().String()
+}
+
+func (f *fakeRedis) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(conn)
+	}
+}
+
+// dropConnections closes every open connection, as a restart or the server's idle timeout would
+func (f *fakeRedis) dropConnections() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for conn := range f.conns {
+		conn.Close()
+	}
+}
+
+func (f *fakeRedis) handle(conn net.Conn) {
+	f.mu.Lock()
+	f.conns[conn] = true
+	f.mu.Unlock()
+
+	defer func() {
+		f.mu.Lock()
+		delete(f.conns, conn)
+		f.mu.Unlock()
+		conn.Close()
+	}()
+
+	r := bufio.NewReader(conn)
+	authed := f.password == ""
+	db := 0
+
+	for {
+		reply, err := readRESP(r)
+		if err != nil {
+			return
+		}
+		items, _ := reply.([]interface{})
+		args := make([]string, len(items))
+		for i, item := range items {
+			args[i], _ = item.(string)
+		}
+		if len(args) == 0 {
+			return
+		}
+
+		cmd := strings.ToUpper(args[0])
+		f.mu.Lock()
+		f.commands = append(f.commands, cmd)
+		f.mu.Unlock()
+
+		var out string
+		switch {
+		case cmd == "AUTH":
+			if args[1] == f.password {
+				authed = true
+				out = "+OK\r\n"
+			} else {
+				out = "-WRONGPASS invalid password\r\n"
+			}
+		case !authed:
+			out = "-NOAUTH Authentication required.\r\n"
+		case cmd == "PING":
+			out = "+PONG\r\n"
+		case cmd == "SELECT":
+			db, _ = strconv.Atoi(args[1])
+			out = "+OK\r\n"
+		case cmd == "GET":
+			if value, ok := f.get(db, args[1]); ok {
+				out = "$" + strconv.Itoa(len(value)) + "\r\n" + value + "\r\n"
+			} else {
+				out = "$-1\r\n"
+			}
+		case cmd == "SET":
+			value := fakeRedisValue{value: args[2]}
+			if len(args) == 5 && strings.ToUpper(args[3]) == "PX" {
+				ms, _ := strconv.ParseInt(args[4], 10, 64)
+				value.expiresAt = time.Now().Add(time.Duration(ms) * time.Millisecond)
+			}
+			f.mu.Lock()
+			if f.dbs[db] == nil {
+				f.dbs[db] = make(map[string]fakeRedisValue)
+			}
+			f.dbs[db][args[1]] = value
+			f.mu.Unlock()
+			out = "+OK\r\n"
+		case cmd == "DEL":
+			f.mu.Lock()
+			_, existed := f.dbs[db][args[1]]
+			delete(f.dbs[db], args[1])
+			f.mu.Unlock()
+			if existed {
+				out = ":1\r\n"
+			} else {
+				out = ":0\r\n"
+			}
+		case cmd == "PTTL":
+			f.mu.Lock()
+			value, exists := f.dbs[db][args[1]]
+			f.mu.Unlock()
+			switch {
+			case !exists:
+				out = ":-2\r\n"
+			case value.expiresAt.IsZero():
+				out = ":-1\r\n"
+			default:
+				out = ":" + strconv.FormatInt(time.Until(value.expiresAt).Milliseconds(), 10) + "\r\n"
+			}
+		case cmd == "FLUSHDB":
+			f.mu.Lock()
+			delete(f.dbs, db)
+			f.mu.Unlock()
+			out = "+OK\r\n"
+		case cmd == "DBSIZE":
+			f.mu.Lock()
+			out = ":" + strconv.Itoa(len(f.dbs[db])) + "\r\n"
+			f.mu.Unlock()
+		case cmd == "INFO":
+			info := "# Stats\r\nexpired_keys:3\r\nevicted_keys:7\r\n"
+			out = "$" + strconv.Itoa(len(info)) + "\r\n" + info + "\r\n"
+		default:
+			out = "-ERR unknown command '" + args[0] + "'\r\n"
+		}
+
+		if _, err := conn.Write([]byte(out)); err != nil {
+			return
+		}
+	}
+}
+
+func (f *fakeRedis) get(db int, key string) (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	value, ok := f.dbs[db][key]
+	if !ok || (!value.expiresAt.IsZero() && time.Now().After(value.expiresAt)) {
+		return "", false
+	}
+	return value.value, true
+}
+
+func (f *fakeRedis) ttl(db int, key string) time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return time.Until(f.dbs[db][key].expiresAt)
+}
+
+func TestRedisCacheInterface(t *testing.T) {
+	server := newFakeRedis(t, "")
+
+	// test RedisCache implements interface
+	var cache CacheInterface = NewRedisCache(server.addr(), "", 0, time.Hour)
+
+	cache.Set("qwerty", "https://example.com")
+
+	longURL, found := cache.Get("qwerty")
+	assert.True(t, found)
+	assert.Equal(t, "https://example.com", longURL)
+	assert.Equal(t, 1, cache.Size())
+
+	cache.Delete("qwerty")
+
+	_, found = cache.Get("qwerty")
+	assert.False(t, found)
+	assert.Equal(t, 0, cache.Size())
+}
+
+func TestRedisCacheTTL(t *testing.T) {
+	tests := []struct {
+		name        string
+		set         func(c *RedisCache)
+		expectFound bool
+		expectTTL   time.Duration
+	}{
+		{
+			name:        "set uses cache ttl",
+			set:         func(c *RedisCache) { c.Set("qwerty", "https://example.com") },
+			expectFound: true,
+			expectTTL:   time.Hour,
+		},
+		{
+			name: "set with expiry uses link expiry when sooner",
+			set: func(c *RedisCache) {
+				c.SetWithExpiry("qwerty", "https://example.com", time.Now().Add(10*time.Minute))
+			},
+			expectFound: true,
+			expectTTL:   10 * time.Minute,
+		},
+		{
+			name: "set with expiry is capped at cache ttl",
+			set: func(c *RedisCache) {
+				c.SetWithExpiry("qwerty", "https://example.com", time.Now().Add(48*time.Hour))
+			},
+			expectFound: true,
+			expectTTL:   time.Hour,
+		},
+		{
+			name: "set with past expiry removes entry",
+			set: func(c *RedisCache) {
+				c.Set("qwerty", "https://stale.example.com")
+				c.SetWithExpiry("qwerty", "https://example.com", time.Now().Add(-time.Minute))
+			},
+			expectFound: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeRedis(t, "")
+			cache := NewRedisCache(server.addr(), "", 0, time.Hour)
+
+			tt.set(cache)
+
+			longURL, found := cache.Get("qwerty")
+			assert.Equal(t, tt.expectFound, found)
+			if tt.expectFound {
+				assert.Equal(t, "https://example.com", longURL)
+				assert.InDelta(t, float64(tt.expectTTL), float64(server.ttl(0, redisKeyPrefix+"qwerty")), float64(time.Second))
+			}
+		})
+	}
+}
+
+func TestRedisCacheAuthAndSelect(t *testing.T) {
+	server := newFakeRedis(t, "secret")
+
+	cache := NewRedisCache(server.addr(), "secret", 2, time.Hour)
+	require.NoError(t, cache.Ping())
+
+	cache.Set("qwerty", "https://example.com")
+	_, found := server.get(2, redisKeyPrefix+"qwerty")
+	assert.True(t, found)
+	assert.Equal(t, []string{"AUTH", "SELECT", "PING", "SET"}, server.commands)
+
+	// a wrong password fails the ping and reads as a miss
+	wrong := NewRedisCache(server.addr(), "wrong", 2, time.Hour)
+	assert.Error(t, wrong.Ping())
+	_, found = wrong.Get("qwerty")
+	assert.False(t, found)
+}
+
+func TestRedisCacheUnavailable(t *testing.T) {
+	server := newFakeRedis(t, "")
+	addr := server.addr()
+	server.listener.Close()
+
+	cache := NewRedisCache(addr, "", 0, time.Hour)
+	assert.Error(t, cache.Ping())
+
+	// failures are treated as misses rather than surfaced
+	cache.Set("qwerty", "https://example.com")
+	_, found := cache.Get("qwerty")
+	assert.False(t, found)
+	assert.Equal(t, 0, cache.Size())
+}
+
+func TestRedisCacheNegativeEntries(t *testing.T) {
+	server := newFakeRedis(t, "")
+	cache := NewRedisCache(server.addr(), "", 0, time.Hour)
+
+	cache.SetMissing("qwerty", time.Minute)
+	assert.True(t, cache.IsMissing("qwerty"))
+	_, found := cache.Get("qwerty")
+	assert.False(t, found)
+
+	// a mapping replaces the negative entry
+	cache.Set("qwerty", "https://example.com")
+	assert.False(t, cache.IsMissing("qwerty"))
+	longURL, found := cache.Get("qwerty")
+	assert.True(t, found)
+	assert.Equal(t, "https://example.com", longURL)
+
+	cache.SetMissing("other", time.Minute)
+	cache.Delete("other")
+	assert.False(t, cache.IsMissing("other"))
+}
+
+func TestRedisCacheStatsPeekAndFlush(t *testing.T) {
+	server := newFakeRedis(t, "")
+	cache := NewRedisCache(server.addr(), "", 0, time.Hour)
+
+	cache.Set("qwerty", "https://example.com")
+	cache.SetMissing("probe", time.Minute)
+	cache.Get("qwerty")
+	cache.Get("probe")
+	cache.Get("unknown")
+
+	assert.Equal(t, Stats{Hits: 1, Misses: 2, Expirations: 3, Evictions: 7, Size: 2}, cache.Stats())
+
+	item, found := cache.Peek("qwerty")
+	assert.True(t, found)
+	assert.Equal(t, "https://example.com", item.LongURL)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), item.ExpiresAt, time.Second)
+
+	item, found = cache.Peek("probe")
+	assert.True(t, found)
+	assert.True(t, item.Missing)
+
+	_, found = cache.Peek("unknown")
+	assert.False(t, found)
+
+	cache.Flush()
+	assert.Equal(t, 0, cache.Size())
+}
+
+func TestRedisCachePeekLinkExpiry(t *testing.T) {
+	server := newFakeRedis(t, "")
+	cache := NewRedisCache(server.addr(), "", 0, time.Minute)
+	linkExpiresAt := time.Now().Add(48 * time.Hour).Truncate(time.Millisecond)
+
+	cache.SetWithExpiry("expiring", "https://example.com/expiring", linkExpiresAt)
+	cache.Set("forever", "https://example.com/forever")
+
+	// the key lives for the cache TTL, the link much longer
+	item, found := cache.Peek("expiring")
+	assert.True(t, found)
+	assert.Equal(t, "https://example.com/expiring", item.LongURL)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), item.ExpiresAt, time.Second)
+	assert.True(t, linkExpiresAt.Equal(item.LinkExpiresAt))
+
+	item, found = cache.Peek("forever")
+	assert.True(t, found)
+	assert.Equal(t, "https://example.com/forever", item.LongURL)
+	assert.True(t, item.LinkExpiresAt.IsZero())
+}
+
+func TestRedisCacheKeyPrefix(t *testing.T) {
+	server := newFakeRedis(t, "")
+	urls := NewRedisCache(server.addr(), "", 0, time.Hour)
+	reverse := NewRedisCache(server.addr(), "", 1, time.Hour, WithRedisKeyPrefix("rev:"))
+
+	urls.Set("qwerty", "https://example.com")
+	reverse.Set("9f86d081", "qwerty")
+
+	_, found := server.get(1, "rev:9f86d081")
+	assert.True(t, found)
+
+	// a cache in its own db isn't counted or flushed with the other
+	assert.Equal(t, 1, urls.Size())
+	urls.Flush()
+	assert.Equal(t, 0, urls.Size())
+	shortCode, found := reverse.Get("9f86d081")
+	assert.True(t, found)
+	assert.Equal(t, "qwerty", shortCode)
+}
+
+func TestRedisCacheRetriesStaleConnection(t *testing.T) {
+	server := newFakeRedis(t, "")
+	cache := NewRedisCache(server.addr(), "", 0, time.Hour)
+
+	cache.Set("qwerty", "https://example.com")
+	cache.Set("other", "https://example.org")
+
+	// the pooled connection is now closed on the server's side, the next command has to redial rather than be lost
+	server.dropConnections()
+	cache.Delete("qwerty")
+
+	_, found := server.get(0, redisKeyPrefix+"qwerty")
+	assert.False(t, found)
+	longURL, found := cache.Get("other")
+	assert.True(t, found)
+	assert.Equal(t, "https://example.org", longURL)
+}
@@ -0,0 +1,142 @@
+package cache
+
+import "time"
+
+// Compile-time check that ShardedCache implements Cache interface
+var _ CacheInterface = (*ShardedCache)(nil)
+
+// lock-striped cache: short codes hash into N independently locked InMemoryCache shards,
+// so redirects for different codes rarely wait on the same mutex
+// size bounds are split evenly across shards, so LRU eviction is per shard and approximate overall
+// expiry cleanup is incremental, one shard per tick, instead of one full scan under a single lock
+
+// ShardedCache spreads URL mappings over independently locked shards
+type ShardedCache struct {
+	shards []*InMemoryCache
+}
+
+// NewShardedCache creates a cache of n shards with the given TTL, options apply to every shard
+func NewShardedCache(ttl time.Duration, n int, opts ...Option) *ShardedCache {
+	if n <= 0 {
+		n = 1
+	}
+
+	c := &ShardedCache{shards: make([]*InMemoryCache, n)}
+	for i := range c.shards {
+		shard := newInMemoryCache(ttl, opts...)
+		shard.maxEntries = perShard(shard.maxEntries, n)
+		shard.maxBytes = perShard(shard.maxBytes, n)
+		c.shards[i] = shard
+	}
+
+	// start cleanup routine
+	go c.cleanupExpired()
+
+	return c
+}
+
+// perShard splits a bound across n shards rounding up, 0 stays unbounded
+func perShard[T int | int64](bound T, n int) T {
+	if bound <= 0 {
+		return 0
+	}
+	return (bound + T(n) - 1) / T(n)
+}
+
+// shard returns the shard holding a short code
+// hashes with FNV-1a inline, hash/fnv would allocate on every lookup
+func (c *ShardedCache) shard(shortCode string) *InMemoryCache {
+	const (
+		offset32 = 2166136261
+		prime32  = 16777619
+	)
+
+	h := uint32(offset32)
+	for i := 0; i < len(shortCode); i++ {
+		h ^= uint32(shortCode[i])
+		h *= prime32
+	}
+	return c.shards[h%uint32(len(c.shards))]
+}
+
+// Get retrieves a long URL from the short code's shard
+func (c *ShardedCache) Get(shortCode string) (string, bool) {
+	return c.shard(shortCode).Get(shortCode)
+}
+
+// Set stores a URL mapping in the short code's shard
+func (c *ShardedCache) Set(shortCode, longURL string) {
+	c.shard(shortCode).Set(shortCode, longURL)
+}
+
+// SetWithExpiry stores a URL mapping that expires at the earlier of the cache TTL and expiresAt
+func (c *ShardedCache) SetWithExpiry(shortCode, longURL string, expiresAt time.Time) {
+	c.shard(shortCode).SetWithExpiry(shortCode, longURL, expiresAt)
+}
+
+// Delete removes an item from the short code's shard
+func (c *ShardedCache) Delete(shortCode string) {
+	c.shard(shortCode).Delete(shortCode)
+}
+
+// SetMissing stores a negative entry in the short code's shard
+func (c *ShardedCache) SetMissing(shortCode string, ttl time.Duration) {
+	c.shard(shortCode).SetMissing(shortCode, ttl)
+}
+
+// IsMissing reports whether the short code's shard holds a negative entry for it
+func (c *ShardedCache) IsMissing(shortCode string) bool {
+	return c.shard(shortCode).IsMissing(shortCode)
+}
+
+// Peek returns the entry for a short code without touching the LRU order or counters
+func (c *ShardedCache) Peek(shortCode string) (CacheItem, bool) {
+	return c.shard(shortCode).Peek(shortCode)
+}
+
+// Size returns the number of items across all shards, each shard is read-locked in turn
+func (c *ShardedCache) Size() int {
+	size := 0
+	for _, shard := range c.shards {
+		size += shard.Size()
+	}
+	return size
+}
+
+// Stats returns the counters of all shards combined
+func (c *ShardedCache) Stats() Stats {
+	var stats Stats
+	for _, shard := range c.shards {
+		s := shard.Stats()
+		stats.Hits += s.Hits
+		stats.Misses += s.Misses
+		stats.Expirations += s.Expirations
+		stats.Evictions += s.Evictions
+		stats.Size += s.Size
+	}
+	return stats
+}
+
+// Flush empties every shard
+func (c *ShardedCache) Flush() {
+	for _, shard := range c.shards {
+		shard.Flush()
+	}
+}
+
+// cleanupExpired cleans one shard per tick, round-robin, visiting every shard once per half TTL like InMemoryCache
+func (c *ShardedCache) cleanupExpired() {
+	interval := c.shards[0].ttl / 2 / time.Duration(len(c.shards))
+	if interval <= 0 {
+		interval = time.Millisecond
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	next := 0
+	for range ticker.C {
+		c.shards[next].cleanup()
+		next = (next + 1) % len(c.shards)
+	}
+}
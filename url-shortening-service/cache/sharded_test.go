@@ -0,0 +1,200 @@
+package cache
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShardedCache(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(c *ShardedCache)
+		check func(t *testing.T, c *ShardedCache)
+	}{
+		{
+			name: "set, get and delete across shards",
+			setup: func(c *ShardedCache) {
+				for i := 0; i < 100; i++ {
+					c.Set("code"+strconv.Itoa(i), "https://example.com/"+strconv.Itoa(i))
+				}
+				c.Delete("code7")
+			},
+			check: func(t *testing.T, c *ShardedCache) {
+				assert.Equal(t, 99, c.Size())
+				longURL, found := c.Get("code42")
+				assert.True(t, found)
+				assert.Equal(t, "https://example.com/42", longURL)
+				_, found = c.Get("code7")
+				assert.False(t, found)
+
+				// spread over more than one shard
+				used := 0
+				for _, shard := range c.shards {
+					if shard.Size() > 0 {
+						used++
+					}
+				}
+				assert.Greater(t, used, 1)
+			},
+		},
+		{
+			name: "negative entries",
+			setup: func(c *ShardedCache) {
+				c.SetMissing("probe", time.Minute)
+			},
+			check: func(t *testing.T, c *ShardedCache) {
+				assert.True(t, c.IsMissing("probe"))
+				item, found := c.Peek("probe")
+				assert.True(t, found)
+				assert.True(t, item.Missing)
+			},
+		},
+		{
+			name: "stats are summed over shards",
+			setup: func(c *ShardedCache) {
+				c.Set("qwerty", "https://example.com")
+				c.Set("asdfgh", "https://example.com/2")
+				c.Get("qwerty")
+				c.Get("asdfgh")
+				c.Get("unknown")
+			},
+			check: func(t *testing.T, c *ShardedCache) {
+				assert.Equal(t, Stats{Hits: 2, Misses: 1, Size: 2}, c.Stats())
+			},
+		},
+		{
+			name: "flush empties every shard",
+			setup: func(c *ShardedCache) {
+				for i := 0; i < 20; i++ {
+					c.Set("code"+strconv.Itoa(i), "https://example.com")
+				}
+				c.Flush()
+			},
+			check: func(t *testing.T, c *ShardedCache) {
+				assert.Equal(t, 0, c.Size())
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := NewShardedCache(time.Hour, 8)
+			tt.setup(cache)
+			tt.check(t, cache)
+		})
+	}
+}
+
+func TestShardedCacheBounds(t *testing.T) {
+	// 10 entries over 4 shards is 3 per shard
+	cache := NewShardedCache(time.Hour, 4, WithMaxEntries(10))
+	for _, shard := range cache.shards {
+		assert.Equal(t, 3, shard.maxEntries)
+	}
+
+	for i := 0; i < 100; i++ {
+		cache.Set("code"+strconv.Itoa(i), "https://example.com")
+	}
+	assert.LessOrEqual(t, cache.Size(), 12)
+	assert.Equal(t, int64(100-cache.Size()), cache.Stats().Evictions)
+}
+
+func TestShardedCacheIncrementalCleanup(t *testing.T) {
+	// every shard is cleaned once per half TTL
+	cache := NewShardedCache(40*time.Millisecond, 4)
+	for i := 0; i < 20; i++ {
+		cache.Set("code"+strconv.Itoa(i), "https://example.com")
+	}
+
+	assert.Eventually(t, func() bool {
+		return cache.Size() == 0
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, int64(20), cache.Stats().Expirations)
+}
+
+// benchmarks compare the single-lock InMemoryCache with ShardedCache under parallel load,
+// run with: go test ./cache -bench . -cpu 1,4,16
+
+const benchmarkKeys = 10000
+
+func benchmarkCaches() map[string]func() CacheInterface {
+	return map[string]func() CacheInterface{
+		"InMemoryCache": func() CacheInterface { return NewInMemoryCache(time.Hour) },
+		"ShardedCache":  func() CacheInterface { return NewShardedCache(time.Hour, 16) },
+	}
+}
+
+func populatedCache(newCache func() CacheInterface) (CacheInterface, []string) {
+	cache := newCache()
+	keys := make([]string, benchmarkKeys)
+	for i := range keys {
+		keys[i] = "code" + strconv.Itoa(i)
+		cache.Set(keys[i], "https://example.com/"+keys[i])
+	}
+	return cache, keys
+}
+
+func BenchmarkGetParallel(b *testing.B) {
+	for name, newCache := range benchmarkCaches() {
+		b.Run(name, func(b *testing.B) {
+			cache, keys := populatedCache(newCache)
+			b.ResetTimer()
+
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					cache.Get(keys[i%benchmarkKeys])
+					i++
+				}
+			})
+		})
+	}
+}
+
+// 90% reads, 10% writes, roughly redirects against new links and refreshes
+func BenchmarkMixedParallel(b *testing.B) {
+	for name, newCache := range benchmarkCaches() {
+		b.Run(name, func(b *testing.B) {
+			cache, keys := populatedCache(newCache)
+			b.ResetTimer()
+
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					key := keys[i%benchmarkKeys]
+					if i%10 == 0 {
+						cache.Set(key, "https://example.com/"+key)
+					} else {
+						cache.Get(key)
+					}
+					i++
+				}
+			})
+		})
+	}
+}
+
+// Size under concurrent reads, which used to take the write lock
+func BenchmarkSizeParallel(b *testing.B) {
+	for name, newCache := range benchmarkCaches() {
+		b.Run(name, func(b *testing.B) {
+			cache, keys := populatedCache(newCache)
+			b.ResetTimer()
+
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					if i%100 == 0 {
+						cache.Size()
+					} else {
+						cache.Get(keys[i%benchmarkKeys])
+					}
+					i++
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,311 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// snapshots let a single-node deployment come back warm: live entries are written to a local file on shutdown
+// and the unexpired ones reloaded at startup
+//
+// file format, integers big-endian:
+//
+//	header  magic "USCS" | version uint16
+//	record  payload length uint32 | payload | CRC-32 (IEEE) of payload uint32
+//	payload uvarint len | short code | uvarint len | long URL | expiresAt unix nanos int64 | link expiresAt unix nanos int64, 0 for none
+//
+// records are written least recently used first so loading them restores the LRU order
+// a record that is truncated or fails its checksum ends the load, the records before it are kept
+
+const (
+	snapshotMagic   = "USCS"
+	snapshotVersion = 1
+
+	// maxSnapshotRecord guards against allocating for a corrupt length
+	maxSnapshotRecord = 1 << 20
+)
+
+var (
+	ErrSnapshotFormat  = errors.New("not a cache snapshot or unsupported version")
+	ErrSnapshotCorrupt = errors.New("cache snapshot is corrupt or truncated")
+)
+
+// Snapshotter is implemented by caches that can persist their entries across restarts
+type Snapshotter interface {
+	// SaveSnapshot writes the live entries to path, replacing it atomically
+	SaveSnapshot(path string) error
+	// LoadSnapshot loads the unexpired entries from path and returns how many it loaded, a missing file loads nothing
+	LoadSnapshot(path string) (int, error)
+}
+
+var (
+	_ Snapshotter = (*InMemoryCache)(nil)
+	_ Snapshotter = (*ShardedCache)(nil)
+)
+
+// snapshotEntry is one cached mapping as stored in a snapshot
+type snapshotEntry struct {
+	shortCode     string
+	longURL       string
+	expiresAt     time.Time
+	linkExpiresAt time.Time
+}
+
+// SaveSnapshot writes the cache's unexpired mappings to path, negative entries are left out
+func (c *InMemoryCache) SaveSnapshot(path string) error {
+	return writeSnapshot(path, c.snapshotEntries())
+}
+
+// LoadSnapshot loads the unexpired mappings from path into the cache
+func (c *InMemoryCache) LoadSnapshot(path string) (int, error) {
+	loaded := 0
+	err := readSnapshot(path, func(e snapshotEntry) {
+		if c.restore(e) {
+			loaded++
+		}
+	})
+	return loaded, err
+}
+
+// SaveSnapshot writes the unexpired mappings of every shard to one file at path
+func (c *ShardedCache) SaveSnapshot(path string) error {
+	var entries []snapshotEntry
+	for _, shard := range c.shards {
+		entries = append(entries, shard.snapshotEntries()...)
+	}
+	return writeSnapshot(path, entries)
+}
+
+// LoadSnapshot loads the unexpired mappings from path, each into its short code's shard
+func (c *ShardedCache) LoadSnapshot(path string) (int, error) {
+	loaded := 0
+	err := readSnapshot(path, func(e snapshotEntry) {
+		if c.shard(e.shortCode).restore(e) {
+			loaded++
+		}
+	})
+	return loaded, err
+}
+
+// snapshotEntries copies the unexpired mappings, least recently used first
+func (c *InMemoryCache) snapshotEntries() []snapshotEntry {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := time.Now()
+	entries := make([]snapshotEntry, 0, len(c.items))
+	for e := c.lruList().Back(); e != nil; e = e.Prev() {
+		shortCode := e.Value.(string)
+		item := c.items[shortCode]
+		if item.Missing || now.After(item.ExpiresAt) {
+			continue
+		}
+		entries = append(entries, snapshotEntry{
+			shortCode:     shortCode,
+			longURL:       item.LongURL,
+			expiresAt:     item.ExpiresAt,
+			linkExpiresAt: item.LinkExpiresAt,
+		})
+	}
+
+	return entries
+}
+
+// restore stores a snapshot entry unless it has expired, never beyond the current cache TTL
+func (c *InMemoryCache) restore(e snapshotEntry) bool {
+	if !time.Now().Before(e.expiresAt) {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	item := c.newItem(e.longURL, e.linkExpiresAt)
+	if e.expiresAt.Before(item.ExpiresAt) {
+		item.ExpiresAt = e.expiresAt
+		if c.loader != nil {
+			item.staleUntil = c.staleDeadline(item, item.ExpiresAt)
+		}
+	}
+	c.store(e.shortCode, item)
+
+	return true
+}
+
+// writeSnapshot writes entries to a temporary file next to path and renames it into place,
+// so a crash mid-write never leaves a partial snapshot at path
+func writeSnapshot(path string, entries []snapshotEntry) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create cache snapshot: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	w := bufio.NewWriter(tmp)
+	if err := encodeSnapshot(w, entries); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write cache snapshot: %w", err)
+	}
+
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write cache snapshot: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write cache snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write cache snapshot: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace cache snapshot: %w", err)
+	}
+
+	return nil
+}
+
+func encodeSnapshot(w io.Writer, entries []snapshotEntry) error {
+	header := make([]byte, 0, len(snapshotMagic)+2)
+	header = append(header, snapshotMagic...)
+	header = binary.BigEndian.AppendUint16(header, snapshotVersion)
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	var payload, record []byte
+	for _, e := range entries {
+		payload = payload[:0]
+		payload = binary.AppendUvarint(payload, uint64(len(e.shortCode)))
+		payload = append(payload, e.shortCode...)
+		payload = binary.AppendUvarint(payload, uint64(len(e.longURL)))
+		payload = append(payload, e.longURL...)
+		payload = binary.BigEndian.AppendUint64(payload, uint64(e.expiresAt.UnixNano()))
+		payload = binary.BigEndian.AppendUint64(payload, uint64(unixNanoOrZero(e.linkExpiresAt)))
+
+		record = record[:0]
+		record = binary.BigEndian.AppendUint32(record, uint32(len(payload)))
+		record = append(record, payload...)
+		record = binary.BigEndian.AppendUint32(record, crc32.ChecksumIEEE(payload))
+		if _, err := w.Write(record); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readSnapshot calls fn for each record in the snapshot at path, a missing file is not an error
+func readSnapshot(path string, fn func(snapshotEntry)) error {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open cache snapshot: %w", err)
+	}
+	defer f.Close()
+
+	return decodeSnapshot(bufio.NewReader(f), fn)
+}
+
+func decodeSnapshot(r io.Reader, fn func(snapshotEntry)) error {
+	header := make([]byte, len(snapshotMagic)+2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return ErrSnapshotFormat
+	}
+	if string(header[:len(snapshotMagic)]) != snapshotMagic ||
+		binary.BigEndian.Uint16(header[len(snapshotMagic):]) != snapshotVersion {
+		return ErrSnapshotFormat
+	}
+
+	var lenBuf [4]byte
+	for {
+		if _, err := io.ReadFull(r, lenBuf[:]); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return ErrSnapshotCorrupt
+		}
+
+		n := binary.BigEndian.Uint32(lenBuf[:])
+		if n > maxSnapshotRecord {
+			return ErrSnapshotCorrupt
+		}
+
+		record := make([]byte, n+4)
+		if _, err := io.ReadFull(r, record); err != nil {
+			return ErrSnapshotCorrupt
+		}
+
+		payload := record[:n]
+		if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(record[n:]) {
+			return ErrSnapshotCorrupt
+		}
+
+		e, err := decodeSnapshotEntry(payload)
+		if err != nil {
+			return err
+		}
+		fn(e)
+	}
+}
+
+func decodeSnapshotEntry(payload []byte) (snapshotEntry, error) {
+	r := bytes.NewReader(payload)
+
+	shortCode, err := readSnapshotString(r)
+	if err != nil {
+		return snapshotEntry{}, ErrSnapshotCorrupt
+	}
+	longURL, err := readSnapshotString(r)
+	if err != nil {
+		return snapshotEntry{}, ErrSnapshotCorrupt
+	}
+
+	var times [2]int64
+	if err := binary.Read(r, binary.BigEndian, &times); err != nil {
+		return snapshotEntry{}, ErrSnapshotCorrupt
+	}
+
+	e := snapshotEntry{
+		shortCode: shortCode,
+		longURL:   longURL,
+		expiresAt: time.Unix(0, times[0]),
+	}
+	if times[1] != 0 {
+		e.linkExpiresAt = time.Unix(0, times[1])
+	}
+
+	return e, nil
+}
+
+func readSnapshotString(r *bytes.Reader) (string, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil || n > uint64(r.Len()) {
+		return "", ErrSnapshotCorrupt
+	}
+
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+func unixNanoOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
@@ -0,0 +1,192 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+	linkExpiresAt := time.Now().Add(10 * time.Minute)
+
+	cache := NewInMemoryCache(time.Hour)
+	cache.Set("qwerty", "https://example.com")
+	cache.SetWithExpiry("expiring", "https://example.com/expiring", linkExpiresAt)
+	cache.SetWithExpiry("expired", "https://example.com/expired", time.Now().Add(-time.Minute))
+	cache.SetMissing("probe", time.Minute)
+	require.NoError(t, cache.SaveSnapshot(path))
+
+	restored := NewInMemoryCache(time.Hour)
+	n, err := restored.LoadSnapshot(path)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	longURL, found := restored.Get("qwerty")
+	assert.True(t, found)
+	assert.Equal(t, "https://example.com", longURL)
+
+	// keeps the link's own expiry
+	item, found := restored.Peek("expiring")
+	assert.True(t, found)
+	assert.True(t, linkExpiresAt.Equal(item.ExpiresAt))
+
+	// expired and negative entries aren't persisted
+	_, found = restored.Peek("expired")
+	assert.False(t, found)
+	_, found = restored.Peek("probe")
+	assert.False(t, found)
+
+	// no temporary files left behind
+	files, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, files, 1)
+}
+
+func TestSnapshotRestoresLRUOrder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+
+	cache := NewInMemoryCache(time.Hour)
+	for i := 0; i < 5; i++ {
+		cache.Set("code"+strconv.Itoa(i), "https://example.com")
+	}
+	cache.Get("code0")
+	require.NoError(t, cache.SaveSnapshot(path))
+
+	// a smaller cache keeps the most recently used entries
+	restored := NewInMemoryCache(time.Hour, WithMaxEntries(2))
+	_, err := restored.LoadSnapshot(path)
+	require.NoError(t, err)
+
+	_, found := restored.Peek("code0")
+	assert.True(t, found)
+	_, found = restored.Peek("code4")
+	assert.True(t, found)
+	assert.Equal(t, 2, restored.Size())
+}
+
+func TestSnapshotCappedByTTL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+
+	cache := NewInMemoryCache(time.Hour)
+	cache.Set("qwerty", "https://example.com")
+	cache.SetWithExpiry("soon", "https://example.com/soon", time.Now().Add(20*time.Millisecond))
+	require.NoError(t, cache.SaveSnapshot(path))
+	time.Sleep(30 * time.Millisecond)
+
+	restored := NewInMemoryCache(time.Minute)
+	n, err := restored.LoadSnapshot(path)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	item, found := restored.Peek("qwerty")
+	assert.True(t, found)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), item.ExpiresAt, time.Second)
+}
+
+func TestShardedSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+
+	cache := NewShardedCache(time.Hour, 4)
+	for i := 0; i < 20; i++ {
+		cache.Set("code"+strconv.Itoa(i), "https://example.com/"+strconv.Itoa(i))
+	}
+	require.NoError(t, cache.SaveSnapshot(path))
+
+	// the format doesn't depend on sharding
+	for _, restored := range []Snapshotter{NewShardedCache(time.Hour, 8), NewInMemoryCache(time.Hour)} {
+		n, err := restored.LoadSnapshot(path)
+		require.NoError(t, err)
+		assert.Equal(t, 20, n)
+
+		longURL, found := restored.(CacheInterface).Get("code13")
+		assert.True(t, found)
+		assert.Equal(t, "https://example.com/13", longURL)
+	}
+}
+
+func TestLoadDamagedSnapshot(t *testing.T) {
+	// a valid snapshot of three entries to damage
+	valid := func(t *testing.T) []byte {
+		path := filepath.Join(t.TempDir(), "valid.snapshot")
+		cache := NewInMemoryCache(time.Hour)
+		cache.Set("code1", "https://example.com/1")
+		cache.Set("code2", "https://example.com/2")
+		cache.Set("code3", "https://example.com/3")
+		require.NoError(t, cache.SaveSnapshot(path))
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		return data
+	}
+
+	tests := []struct {
+		name        string
+		data        func(t *testing.T) []byte
+		expectedN   int
+		expectedErr error
+	}{
+		{
+			name: "missing file",
+		},
+		{
+			name:        "not a snapshot",
+			data:        func(t *testing.T) []byte { return []byte("hello world") },
+			expectedErr: ErrSnapshotFormat,
+		},
+		{
+			name: "unsupported version",
+			data: func(t *testing.T) []byte {
+				data := valid(t)
+				data[5] = snapshotVersion + 1
+				return data
+			},
+			expectedErr: ErrSnapshotFormat,
+		},
+		{
+			name: "truncated",
+			data: func(t *testing.T) []byte {
+				data := valid(t)
+				return data[:len(data)-5]
+			},
+			expectedN:   2,
+			expectedErr: ErrSnapshotCorrupt,
+		},
+		{
+			name: "checksum mismatch",
+			data: func(t *testing.T) []byte {
+				data := valid(t)
+				data[len(data)-10] ^= 0xff
+				return data
+			},
+			expectedN:   2,
+			expectedErr: ErrSnapshotCorrupt,
+		},
+		{
+			name:        "empty file",
+			data:        func(t *testing.T) []byte { return []byte{} },
+			expectedErr: ErrSnapshotFormat,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "cache.snapshot")
+			if tt.data != nil {
+				require.NoError(t, os.WriteFile(path, tt.data(t), 0o600))
+			}
+
+			cache := NewInMemoryCache(time.Hour)
+			n, err := cache.LoadSnapshot(path)
+
+			assert.ErrorIs(t, err, tt.expectedErr)
+			assert.Equal(t, tt.expectedN, n)
+			assert.Equal(t, tt.expectedN, cache.Size())
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// Compile-time check that TieredCache implements Cache interface
+var _ CacheInterface = (*TieredCache)(nil)
+
+// two-tier cache: hot codes are answered from process memory (L1), misses fall through to a shared L2 such as Redis
+// each tier keeps its own TTL, writes go through to both and an L2 hit is promoted into L1
+// L1's background refreshes go through WriteThrough so L2 doesn't keep serving what L1 replaced
+// Delete invalidates both tiers here, but other replicas' L1 only drops the entry when its TTL passes,
+// so keep the L1 TTL short
+
+// TieredCache chains a local L1, an InMemoryCache or ShardedCache, in front of any CacheInterface L2
+type TieredCache struct {
+	l1 CacheInterface
+	l2 CacheInterface
+
+	// hits and misses across both tiers, an L1 miss answered by L2 is one hit
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// NewTieredCache creates a cache reading l1 first and l2 on a miss, the TTLs are those each tier was built with
+func NewTieredCache(l1, l2 CacheInterface) *TieredCache {
+	return &TieredCache{l1: l1, l2: l2}
+}
+
+// Get retrieves a long URL from L1, falling back to L2 and promoting what it finds
+func (c *TieredCache) Get(shortCode string) (string, bool) {
+	if longURL, found := c.l1.Get(shortCode); found {
+		c.hits.Add(1)
+		return longURL, true
+	}
+
+	// Peek rather than Get for the link's own expiry, L1 applies it and its own TTL as if the link were set there
+	item, found := c.l2.Peek(shortCode)
+	if !found || item.Missing {
+		c.misses.Add(1)
+		return "", false
+	}
+
+	if item.LinkExpiresAt.IsZero() {
+		c.l1.Set(shortCode, item.LongURL)
+	} else {
+		c.l1.SetWithExpiry(shortCode, item.LongURL, item.LinkExpiresAt)
+	}
+	c.hits.Add(1)
+	return item.LongURL, true
+}
+
+// WriteThrough wraps the loader of an L1 refreshing stale entries so what it reloads also replaces L2's copy
+func WriteThrough(l2 CacheInterface, loader Loader) Loader {
+	return func(ctx context.Context, shortCode string) (string, *time.Time, error) {
+		longURL, expiresAt, err := loader(ctx, shortCode)
+		switch {
+		case err == nil && expiresAt != nil:
+			l2.SetWithExpiry(shortCode, longURL, *expiresAt)
+		case err == nil:
+			l2.Set(shortCode, longURL)
+		case errors.Is(err, ErrNoLongerValid):
+			l2.Delete(shortCode)
+		}
+		return longURL, expiresAt, err
+	}
+}
+
+// Set stores a URL mapping in both tiers
+func (c *TieredCache) Set(shortCode, longURL string) {
+	c.l2.Set(shortCode, longURL)
+	c.l1.Set(shortCode, longURL)
+}
+
+// SetWithExpiry stores a URL mapping in both tiers, neither outliving expiresAt
+func (c *TieredCache) SetWithExpiry(shortCode, longURL string, expiresAt time.Time) {
+	c.l2.SetWithExpiry(shortCode, longURL, expiresAt)
+	c.l1.SetWithExpiry(shortCode, longURL, expiresAt)
+}
+
+// Delete removes a mapping from both tiers
+func (c *TieredCache) Delete(shortCode string) {
+	c.l2.Delete(shortCode)
+	c.l1.Delete(shortCode)
+}
+
+// SetMissing stores a negative entry in both tiers
+func (c *TieredCache) SetMissing(shortCode string, ttl time.Duration) {
+	c.l2.SetMissing(shortCode, ttl)
+	c.l1.SetMissing(shortCode, ttl)
+}
+
+// IsMissing checks L1 then L2 for a negative entry, promoting one found in L2
+func (c *TieredCache) IsMissing(shortCode string) bool {
+	if c.l1.IsMissing(shortCode) {
+		return true
+	}
+
+	item, found := c.l2.Peek(shortCode)
+	if !found || !item.Missing {
+		return false
+	}
+
+	c.l1.SetMissing(shortCode, time.Until(item.ExpiresAt))
+	return true
+}
+
+// Size returns the number of entries in L2, which holds everything L1 does
+func (c *TieredCache) Size() int {
+	return c.l2.Size()
+}
+
+// Stats returns hits and misses across both tiers, the expirations and evictions of both tiers combined, and L2's size
+func (c *TieredCache) Stats() Stats {
+	l1, l2 := c.l1.Stats(), c.l2.Stats()
+
+	return Stats{
+		Hits:        c.hits.Load(),
+		Misses:      c.misses.Load(),
+		Expirations: l1.Expirations + l2.Expirations,
+		Evictions:   l1.Evictions + l2.Evictions,
+		Size:        l2.Size,
+	}
+}
+
+// Peek returns the entry from L1, or L2 when L1 doesn't hold it
+func (c *TieredCache) Peek(shortCode string) (CacheItem, bool) {
+	if item, found := c.l1.Peek(shortCode); found {
+		return item, true
+	}
+	return c.l2.Peek(shortCode)
+}
+
+// Flush empties both tiers
+func (c *TieredCache) Flush() {
+	c.l2.Flush()
+	c.l1.Flush()
+}
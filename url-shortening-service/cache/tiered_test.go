@@ -0,0 +1,233 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTieredCache(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(c *TieredCache, l1, l2 *InMemoryCache)
+		check func(t *testing.T, c *TieredCache, l1, l2 *InMemoryCache)
+		l1TTL time.Duration
+		l2TTL time.Duration
+	}{
+		{
+			name:  "set writes through to both tiers",
+			setup: func(c *TieredCache, l1, l2 *InMemoryCache) { c.Set("qwerty", "https://example.com") },
+			check: func(t *testing.T, c *TieredCache, l1, l2 *InMemoryCache) {
+				_, found := l1.Peek("qwerty")
+				assert.True(t, found)
+				_, found = l2.Peek("qwerty")
+				assert.True(t, found)
+			},
+		},
+		{
+			name: "delete invalidates both tiers",
+			setup: func(c *TieredCache, l1, l2 *InMemoryCache) {
+				c.Set("qwerty", "https://example.com")
+				c.Delete("qwerty")
+			},
+			check: func(t *testing.T, c *TieredCache, l1, l2 *InMemoryCache) {
+				_, found := c.Get("qwerty")
+				assert.False(t, found)
+				assert.Equal(t, 0, l1.Size())
+				assert.Equal(t, 0, l2.Size())
+			},
+		},
+		{
+			name: "L2 hit is promoted into L1 keeping an expiry sooner than the L1 TTL",
+			setup: func(c *TieredCache, l1, l2 *InMemoryCache) {
+				l2.SetWithExpiry("qwerty", "https://example.com", time.Now().Add(30*time.Second))
+			},
+			check: func(t *testing.T, c *TieredCache, l1, l2 *InMemoryCache) {
+				longURL, found := c.Get("qwerty")
+				assert.True(t, found)
+				assert.Equal(t, "https://example.com", longURL)
+
+				promoted, found := l1.Peek("qwerty")
+				assert.True(t, found)
+				fromL2, _ := l2.Peek("qwerty")
+				assert.Equal(t, fromL2.ExpiresAt, promoted.ExpiresAt)
+			},
+		},
+		{
+			name:  "L2 hit is promoted with the link's expiry rather than L2's TTL",
+			l2TTL: 2 * time.Minute,
+			setup: func(c *TieredCache, l1, l2 *InMemoryCache) {
+				l2.SetWithExpiry("qwerty", "https://example.com", time.Now().Add(time.Hour))
+			},
+			check: func(t *testing.T, c *TieredCache, l1, l2 *InMemoryCache) {
+				_, found := c.Get("qwerty")
+				assert.True(t, found)
+
+				promoted, found := l1.Peek("qwerty")
+				assert.True(t, found)
+				fromL2, _ := l2.Peek("qwerty")
+				assert.Equal(t, fromL2.LinkExpiresAt, promoted.LinkExpiresAt)
+				assert.WithinDuration(t, time.Now().Add(time.Minute), promoted.ExpiresAt, time.Second)
+			},
+		},
+		{
+			name:  "tiers keep separate TTLs",
+			l1TTL: 10 * time.Millisecond,
+			setup: func(c *TieredCache, l1, l2 *InMemoryCache) {
+				c.Set("qwerty", "https://example.com")
+				time.Sleep(20 * time.Millisecond)
+			},
+			check: func(t *testing.T, c *TieredCache, l1, l2 *InMemoryCache) {
+				_, found := l1.Peek("qwerty")
+				assert.False(t, found)
+
+				// answered by L2 once L1 has expired it
+				_, found = c.Get("qwerty")
+				assert.True(t, found)
+			},
+		},
+		{
+			name: "negative entry in L2 is promoted",
+			setup: func(c *TieredCache, l1, l2 *InMemoryCache) {
+				l2.SetMissing("probe", time.Minute)
+			},
+			check: func(t *testing.T, c *TieredCache, l1, l2 *InMemoryCache) {
+				_, found := c.Get("probe")
+				assert.False(t, found)
+				assert.True(t, c.IsMissing("probe"))
+				assert.True(t, l1.IsMissing("probe"))
+			},
+		},
+		{
+			name: "stats count one hit or miss per lookup",
+			setup: func(c *TieredCache, l1, l2 *InMemoryCache) {
+				c.Set("qwerty", "https://example.com")
+				l2.Set("shared", "https://example.com/shared")
+				c.Get("qwerty")
+				c.Get("shared")
+				c.Get("unknown")
+			},
+			check: func(t *testing.T, c *TieredCache, l1, l2 *InMemoryCache) {
+				stats := c.Stats()
+				assert.Equal(t, int64(2), stats.Hits)
+				assert.Equal(t, int64(1), stats.Misses)
+				assert.Equal(t, 2, stats.Size)
+			},
+		},
+		{
+			name: "flush empties both tiers",
+			setup: func(c *TieredCache, l1, l2 *InMemoryCache) {
+				c.Set("qwerty", "https://example.com")
+				c.Flush()
+			},
+			check: func(t *testing.T, c *TieredCache, l1, l2 *InMemoryCache) {
+				assert.Equal(t, 0, l1.Size())
+				assert.Equal(t, 0, l2.Size())
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l1TTL, l2TTL := tt.l1TTL, tt.l2TTL
+			if l1TTL == 0 {
+				l1TTL = time.Minute
+			}
+			if l2TTL == 0 {
+				l2TTL = time.Hour
+			}
+
+			l1 := NewInMemoryCache(l1TTL)
+			l2 := NewInMemoryCache(l2TTL)
+			cache := NewTieredCache(l1, l2)
+
+			tt.setup(cache, l1, l2)
+			tt.check(t, cache, l1, l2)
+		})
+	}
+}
+
+func TestTieredCacheWithRedis(t *testing.T) {
+	server := newFakeRedis(t, "")
+	l1 := NewInMemoryCache(time.Minute)
+	cache := NewTieredCache(l1, NewRedisCache(server.addr(), "", 0, time.Hour))
+
+	cache.Set("qwerty", "https://example.com")
+	l1.Delete("qwerty")
+
+	// another replica's write is visible once L1 misses
+	longURL, found := cache.Get("qwerty")
+	assert.True(t, found)
+	assert.Equal(t, "https://example.com", longURL)
+
+	// promoted with the L1 TTL, not Redis' remaining hour
+	item, found := l1.Peek("qwerty")
+	assert.True(t, found)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), item.ExpiresAt, time.Second)
+}
+
+func TestWriteThrough(t *testing.T) {
+	linkExpiresAt := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name          string
+		loader        Loader
+		expectL2      string
+		expectL2Found bool
+	}{
+		{
+			name: "refreshed value replaces L2's",
+			loader: func(ctx context.Context, shortCode string) (string, *time.Time, error) {
+				return "https://example.com/new", nil, nil
+			},
+			expectL2:      "https://example.com/new",
+			expectL2Found: true,
+		},
+		{
+			name: "refreshed value keeps its link expiry",
+			loader: func(ctx context.Context, shortCode string) (string, *time.Time, error) {
+				return "https://example.com/new", &linkExpiresAt, nil
+			},
+			expectL2:      "https://example.com/new",
+			expectL2Found: true,
+		},
+		{
+			name: "link no longer valid is dropped from L2",
+			loader: func(ctx context.Context, shortCode string) (string, *time.Time, error) {
+				return "", nil, ErrNoLongerValid
+			},
+		},
+		{
+			name: "failed refresh leaves L2 alone",
+			loader: func(ctx context.Context, shortCode string) (string, *time.Time, error) {
+				return "", nil, errors.New("database unavailable")
+			},
+			expectL2:      "https://example.com/old",
+			expectL2Found: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l2 := NewInMemoryCache(time.Hour)
+			l2.Set("qwerty", "https://example.com/old")
+
+			// an L1 entry past its TTL, refreshed in the background on the next Get
+			l1 := NewInMemoryCache(10*time.Millisecond, WithStaleWhileRevalidate(time.Minute, WriteThrough(l2, tt.loader)))
+			cache := NewTieredCache(l1, l2)
+			l1.Set("qwerty", "https://example.com/old")
+			time.Sleep(20 * time.Millisecond)
+
+			_, found := cache.Get("qwerty")
+			assert.True(t, found)
+
+			assert.Eventually(t, func() bool {
+				item, found := l2.Peek("qwerty")
+				return found == tt.expectL2Found && item.LongURL == tt.expectL2
+			}, time.Second, 5*time.Millisecond)
+		})
+	}
+}
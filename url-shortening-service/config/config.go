@@ -15,8 +15,50 @@ type Config struct {
 	Port            int
 	BaseURL         string
 	ShortCodeLength int
+	AliasMinLength  int
+	AliasMaxLength  int
+	BatchMaxSize    int
+	AdminToken      string
 	DB              DBConfig
+	CacheBackend    string
 	CacheTTL        time.Duration
+	CacheL1TTL      time.Duration
+	StaleWindow     time.Duration
+	CacheMaxEntries int
+	CacheMaxBytes   int64
+	CacheShards     int
+	SnapshotPath    string
+	CacheWarmup     CacheWarmupConfig
+	NegativeTTL     time.Duration
+	ReverseCacheTTL time.Duration
+	Redis           RedisConfig
+	DefaultLinkTTL  time.Duration
+	IDGenerator     string
+	TicketBlock     int
+	ObfuscationKey  string
+	Worker          WorkerConfig
+}
+
+// WorkerConfig configures the snowflake generator
+// a non-zero LeaseTTL leases the machine ID from the database instead of using ID
+type WorkerConfig struct {
+	ID          int64
+	LeaseTTL    time.Duration
+	Epoch       time.Time
+	MaxRollback time.Duration
+}
+
+type CacheWarmupConfig struct {
+	Count   int
+	Timeout time.Duration
+}
+
+// RedisConfig locates the Redis server, the reverse cache gets its own db so FLUSHDB and DBSIZE on one leave the other alone
+type RedisConfig struct {
+	Addr      string
+	Password  string
+	DB        int
+	ReverseDB int
 }
 
 type DBConfig struct {
@@ -44,7 +86,11 @@ func LoadConfig() *Config {
 	return &Config{
 		Port:            port,
 		BaseURL:         baseURL,
-		ShortCodeLength: getEnvAsInt("SHORT_CODE_LENGTH", 7),
+		ShortCodeLength: getEnvAsInt("SHORT_CODE_LENGTH", 11),
+		AliasMinLength:  getEnvAsInt("ALIAS_MIN_LENGTH", 4),
+		AliasMaxLength:  getEnvAsInt("ALIAS_MAX_LENGTH", 20),
+		BatchMaxSize:    getEnvAsInt("BATCH_MAX_SIZE", 1000),
+		AdminToken:      getEnv("ADMIN_TOKEN", ""),
 		DB: DBConfig{
 			Host:     getEnv("DATABASE_HOST", "127.0.0.1"),
 			Port:     getEnvAsInt("DATABASE_PORT", 3306),
@@ -52,7 +98,37 @@ func LoadConfig() *Config {
 			User:     getEnv("DATABASE_USER", "url_shorten_service"),
 			Password: getEnv("DATABASE_PASSWORD", "123"),
 		},
-		CacheTTL: getEnvAsDuration("CACHE_TTL_MINUTES", 60) * time.Minute,
+		CacheBackend:    getEnv("CACHE_BACKEND", "memory"),
+		CacheTTL:        getEnvAsDuration("CACHE_TTL_MINUTES", 60) * time.Minute,
+		CacheL1TTL:      getEnvAsDuration("CACHE_L1_TTL_SECONDS", 60) * time.Second,
+		StaleWindow:     getEnvAsDuration("CACHE_STALE_SECONDS", 300) * time.Second,
+		CacheMaxEntries: getEnvAsInt("CACHE_MAX_ENTRIES", 100000),
+		CacheMaxBytes:   int64(getEnvAsInt("CACHE_MAX_MB", 64)) << 20,
+		CacheShards:     getEnvAsInt("CACHE_SHARDS", 16),
+		SnapshotPath:    getEnv("CACHE_SNAPSHOT_PATH", ""),
+		CacheWarmup: CacheWarmupConfig{
+			Count:   getEnvAsInt("CACHE_WARMUP_COUNT", 1000),
+			Timeout: getEnvAsDuration("CACHE_WARMUP_TIMEOUT_SECONDS", 10) * time.Second,
+		},
+		NegativeTTL:     getEnvAsDuration("NEGATIVE_CACHE_TTL_SECONDS", 30) * time.Second,
+		ReverseCacheTTL: getEnvAsDuration("REVERSE_CACHE_TTL_MINUTES", 60) * time.Minute,
+		Redis: RedisConfig{
+			Addr:      getEnv("REDIS_ADDR", "127.0.0.1:6379"),
+			Password:  getEnv("REDIS_PASSWORD", ""),
+			DB:        getEnvAsInt("REDIS_DB", 0),
+			ReverseDB: getEnvAsInt("REDIS_REVERSE_DB", 1),
+		},
+		DefaultLinkTTL: getEnvAsDuration("LINK_TTL_DAYS", 30) * 24 * time.Hour,
+		IDGenerator:    getEnv("ID_GENERATOR", "snowflake"),
+		TicketBlock:    getEnvAsInt("TICKET_BLOCK_SIZE", 1000),
+		ObfuscationKey: getEnv("CODE_OBFUSCATION_KEY", ""),
+		Worker: WorkerConfig{
+			ID:       int64(getEnvAsInt("WORKER_ID", 0)),
+			LeaseTTL: getEnvAsDuration("WORKER_LEASE_SECONDS", 0) * time.Second,
+			Epoch:    getEnvAsTime("SNOWFLAKE_EPOCH", time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)),
+			// how far NTP may step the clock back before ID generation fails instead of waiting
+			MaxRollback: getEnvAsDuration("SNOWFLAKE_MAX_ROLLBACK_MS", 100) * time.Millisecond,
+		},
 	}
 }
 
@@ -76,9 +152,22 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+// getEnvAsTime gets an RFC 3339 environment variable as time or returns a default value
+func getEnvAsTime(key string, defaultValue time.Time) time.Time {
+	strValue := os.Getenv(key)
+	if strValue == "" {
+		return defaultValue
+	}
+	if timeValue, err := time.Parse(time.RFC3339, strValue); err == nil {
+		return timeValue
+	}
+	log.Printf("Warning: %s is not an RFC 3339 time, using %s", key, defaultValue.Format(time.RFC3339))
+	return defaultValue
+}
+
 // GetDSN returns the MySQL connection string
 func (c *Config) GetDSN() string {
-	return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?parseTime=true",
+	return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?parseTime=true&clientFoundRows=true",
 		c.DB.User,
 		c.DB.Password,
 		c.DB.Host,
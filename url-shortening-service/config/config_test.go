@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -16,6 +17,33 @@ func TestNew(t *testing.T) {
 	assert.Equal(t, "urls", cfg.DB.Database)
 	assert.Equal(t, "url_shorten_service", cfg.DB.User)
 	assert.Equal(t, "123", cfg.DB.Password)
+	assert.Equal(t, 11, cfg.ShortCodeLength)
+	assert.Equal(t, 4, cfg.AliasMinLength)
+	assert.Equal(t, 20, cfg.AliasMaxLength)
+	assert.Equal(t, 1000, cfg.BatchMaxSize)
+	assert.Equal(t, 30*24*time.Hour, cfg.DefaultLinkTTL)
+	assert.Equal(t, "snowflake", cfg.IDGenerator)
+	assert.Equal(t, 1000, cfg.TicketBlock)
+	assert.Empty(t, cfg.ObfuscationKey)
+	assert.Equal(t, WorkerConfig{
+		ID:          0,
+		LeaseTTL:    0,
+		Epoch:       time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC),
+		MaxRollback: 100 * time.Millisecond,
+	}, cfg.Worker)
+	assert.Equal(t, 100000, cfg.CacheMaxEntries)
+	assert.Equal(t, int64(64<<20), cfg.CacheMaxBytes)
+	assert.Equal(t, 16, cfg.CacheShards)
+	assert.Equal(t, "memory", cfg.CacheBackend)
+	assert.Equal(t, time.Minute, cfg.CacheL1TTL)
+	assert.Equal(t, 5*time.Minute, cfg.StaleWindow)
+	assert.Equal(t, 30*time.Second, cfg.NegativeTTL)
+	assert.Equal(t, time.Hour, cfg.ReverseCacheTTL)
+	assert.Equal(t, 1000, cfg.CacheWarmup.Count)
+	assert.Equal(t, 10*time.Second, cfg.CacheWarmup.Timeout)
+	assert.Equal(t, "127.0.0.1:6379", cfg.Redis.Addr)
+	assert.Equal(t, 0, cfg.Redis.DB)
+	assert.Equal(t, 1, cfg.Redis.ReverseDB)
 }
 
 func TestNewWithEnvVars(t *testing.T) {
@@ -1,5 +1,23 @@
 package idgenerator
 
+import "errors"
+
+// ErrShortCodeLength is returned when the configured short code length can't hold every ID a generator can produce
+var ErrShortCodeLength = errors.New("short code length can't hold the generator's ID space")
+
 type IDGeneratorInterface interface {
 	GenerateShortCode() (string, error)
+	// GenerateShortCodes returns n short codes in one call, for bulk inserts
+	GenerateShortCodes(n int) ([]string, error)
+}
+
+// NumericIDGenerator generates short codes by base62 encoding numeric IDs, which ObfuscatedGenerator can permute
+type NumericIDGenerator interface {
+	IDGeneratorInterface
+	// GenerateIDs returns the next n IDs, before they're encoded
+	GenerateIDs(n int) ([]int64, error)
+	// ShortCodeLength is the fixed length IDs are encoded to
+	ShortCodeLength() int
+	// MaxID is the largest ID the generator can return
+	MaxID() int64
 }
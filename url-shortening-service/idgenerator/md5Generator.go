@@ -3,13 +3,16 @@ package idgenerator
 import (
 	"crypto/md5"
 	"crypto/rand"
-	"encoding/base64"
+	"math/big"
 	"strings"
 )
 
 // Compile-time check that Md5Generator implements type IDGeneratorInterface interface {
 var _ IDGeneratorInterface = (*Md5Generator)(nil)
 
+// MaxMD5CodeLength is the number of base62 characters an md5 hash encodes to
+const MaxMD5CodeLength = 22
+
 type Md5Generator struct {
 	shortCodeLength int
 }
@@ -20,8 +23,12 @@ func NewMD5Generator(shortCodeLength int) *Md5Generator {
 	}
 }
 
-// md5 hash generation with base64 conversion
+// md5 hash generation with base62 conversion
 func (g *Md5Generator) GenerateShortCode() (string, error) {
+	if g.shortCodeLength < 1 || g.shortCodeLength > MaxMD5CodeLength {
+		return "", ErrShortCodeLength
+	}
+
 	// Generate random bytes
 	bytes := make([]byte, g.shortCodeLength)
 	if _, err := rand.Read(bytes); err != nil {
@@ -32,15 +39,23 @@ func (g *Md5Generator) GenerateShortCode() (string, error) {
 	hasher.Write([]byte(bytes))
 	hash := hasher.Sum(nil)
 
-	// convert to base 64 helps so same number between
-	// its different number representation systems
-	// also makes URL-safe
-	encoded := base64.URLEncoding.EncodeToString(hash)
+	// base62 keeps codes to [0-9a-zA-Z] like the other generators, zero padded to the full hash width
+	encoded := new(big.Int).SetBytes(hash).Text(62)
+	encoded = strings.Repeat("0", MaxMD5CodeLength-len(encoded)) + encoded
 
-	// Take first 7 characters and remove any special chars
-	shortCode := strings.ReplaceAll(encoded[:g.shortCodeLength], "/", "_")
-	shortCode = strings.ReplaceAll(shortCode, "+", "-")
-	shortCode = strings.ReplaceAll(shortCode, "=", "")
+	// take the trailing characters, the leading one only spans part of the charset
+	return encoded[MaxMD5CodeLength-g.shortCodeLength:], nil
+}
 
-	return shortCode, nil
+// GenerateShortCodes generates n independent random short codes
+func (g *Md5Generator) GenerateShortCodes(n int) ([]string, error) {
+	codes := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		code, err := g.GenerateShortCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
 }
@@ -0,0 +1,44 @@
+package idgenerator
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMd5Generator_ShortCodeLength(t *testing.T) {
+	tests := []struct {
+		name    string
+		length  int
+		wantErr error
+	}{
+		{name: "design notes length", length: 8},
+		{name: "whole hash", length: MaxMD5CodeLength},
+		{name: "longer than the hash", length: MaxMD5CodeLength + 1, wantErr: ErrShortCodeLength},
+		{name: "zero", length: 0, wantErr: ErrShortCodeLength},
+	}
+
+	base62 := regexp.MustCompile(`^[0-9a-zA-Z]+$`)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			generator := NewMD5Generator(tt.length)
+			code, err := generator.GenerateShortCode()
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, code, tt.length)
+
+			codes, err := generator.GenerateShortCodes(200)
+			require.NoError(t, err)
+			for _, code := range codes {
+				assert.Len(t, code, tt.length)
+				assert.Regexp(t, base62, code)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package idgenerator
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/bits"
+)
+
+var _ IDGeneratorInterface = (*ObfuscatedGenerator)(nil)
+
+// obfuscation: sequential IDs make codes guessable, so links can be enumerated and volume estimated
+// the decorator passes each ID through a keyed Feistel network, a permutation of the generator's whole ID range,
+// so codes stay unique and fixed-length but consecutive IDs land far apart
+// the key must never change once codes are issued, a new permutation can map new IDs onto old codes
+
+// MinObfuscationKeyLength is the shortest key accepted, shorter keys are easier to brute force from sample codes
+const MinObfuscationKeyLength = 16
+
+// feistelRounds is the number of rounds, 4 is the minimum for a strong pseudorandom permutation
+const feistelRounds = 8
+
+var ErrObfuscationKey = errors.New("obfuscation key must be at least 16 bytes")
+
+type ObfuscatedGenerator struct {
+	ids  NumericIDGenerator
+	key  []byte
+	size uint64
+	half uint
+}
+
+// NewObfuscatedGenerator wraps ids so every code is a keyed permutation of the ID it would have encoded
+func NewObfuscatedGenerator(ids NumericIDGenerator, key []byte) (*ObfuscatedGenerator, error) {
+	if len(key) < MinObfuscationKeyLength {
+		return nil, ErrObfuscationKey
+	}
+
+	// permute over [0, size), the IDs the generator can return, using the smallest even bit width that covers it
+	size := uint64(ids.MaxID()) + 1
+	width := uint(bits.Len64(size - 1))
+	width += width % 2
+	if width < 2 {
+		width = 2
+	}
+
+	return &ObfuscatedGenerator{
+		ids:  ids,
+		key:  append([]byte(nil), key...),
+		size: size,
+		half: width / 2,
+	}, nil
+}
+
+func (g *ObfuscatedGenerator) GenerateShortCode() (string, error) {
+	codes, err := g.GenerateShortCodes(1)
+	if err != nil {
+		return "", err
+	}
+	return codes[0], nil
+}
+
+// GenerateShortCodes generates n short codes from one batch of IDs
+func (g *ObfuscatedGenerator) GenerateShortCodes(n int) ([]string, error) {
+	ids, err := g.ids.GenerateIDs(n)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, id := range ids {
+		ids[i] = int64(g.permute(uint64(id)))
+	}
+	return encodeAll(ids, g.ids.ShortCodeLength()), nil
+}
+
+// permute maps id to another ID in [0, size), distinct IDs always map to distinct IDs
+func (g *ObfuscatedGenerator) permute(id uint64) uint64 {
+	// cycle walking: the Feistel network permutes the whole bit width, so re-apply it until the result is back in range,
+	// which keeps it a permutation of [0, size) and averages under 4 passes as the width is at most 2 bits wider
+	id = g.feistel(id)
+	for id >= g.size {
+		id = g.feistel(id)
+	}
+	return id
+}
+
+// feistel is a balanced Feistel network over 2*half bits, a permutation whatever the round function
+func (g *ObfuscatedGenerator) feistel(x uint64) uint64 {
+	mask := uint64(1)<<g.half - 1
+	left, right := x>>g.half&mask, x&mask
+
+	for round := 0; round < feistelRounds; round++ {
+		left, right = right, left^(g.round(round, right)&mask)
+	}
+
+	return left<<g.half | right
+}
+
+// round is the keyed round function, HMAC-SHA256 of the round number and right half
+func (g *ObfuscatedGenerator) round(round int, right uint64) uint64 {
+	var msg [9]byte
+	msg[0] = byte(round)
+	binary.BigEndian.PutUint64(msg[1:], right)
+
+	mac := hmac.New(sha256.New, g.key)
+	mac.Write(msg[:])
+	return binary.BigEndian.Uint64(mac.Sum(nil))
+}
@@ -0,0 +1,96 @@
+package idgenerator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testObfuscationKey = []byte("0123456789abcdef")
+
+func newObfuscatedTicketGenerator(t *testing.T, codeLength int, blockSize int64, key []byte) *ObfuscatedGenerator {
+	tickets, err := NewTicketGenerator(context.Background(), &fakeTicketLeaser{}, codeLength, WithBlockSize(blockSize))
+	require.NoError(t, err)
+
+	g, err := NewObfuscatedGenerator(tickets, key)
+	require.NoError(t, err)
+	return g
+}
+
+func TestNewObfuscatedGenerator(t *testing.T) {
+	tickets, err := NewTicketGenerator(context.Background(), &fakeTicketLeaser{}, 8)
+	require.NoError(t, err)
+
+	_, err = NewObfuscatedGenerator(tickets, []byte("too short"))
+	assert.Equal(t, ErrObfuscationKey, err)
+}
+
+func TestObfuscatedGenerator_Permutation(t *testing.T) {
+	// every two character code, so the whole ID range is covered
+	const size = 62 * 62
+	g := newObfuscatedTicketGenerator(t, 2, size, testObfuscationKey)
+
+	codes, err := g.GenerateShortCodes(size)
+	require.NoError(t, err)
+
+	seen := make(map[string]bool, size)
+	for _, code := range codes {
+		assert.Len(t, code, 2)
+		assert.False(t, seen[code], "duplicate short code %s", code)
+		seen[code] = true
+	}
+	assert.Len(t, seen, size)
+
+	// consecutive IDs no longer give consecutive codes
+	sequential := 0
+	for i := 1; i < len(codes); i++ {
+		if codes[i] > codes[i-1] {
+			sequential++
+		}
+	}
+	assert.Less(t, sequential, size*3/4)
+
+	// the range is used up, not wrapped around
+	_, err = g.GenerateShortCode()
+	assert.Equal(t, ErrIDSpaceExhausted, err)
+}
+
+func TestObfuscatedGenerator_Keyed(t *testing.T) {
+	generate := func(key []byte) []string {
+		codes, err := newObfuscatedTicketGenerator(t, 8, 100, key).GenerateShortCodes(50)
+		require.NoError(t, err)
+		return codes
+	}
+
+	first := generate(testObfuscationKey)
+	// the same key gives the same codes, so restarts carry on the same permutation
+	assert.Equal(t, first, generate(testObfuscationKey))
+	assert.NotEqual(t, first, generate([]byte("fedcba9876543210")))
+
+	for _, code := range first {
+		assert.Len(t, code, 8)
+		assert.Regexp(t, "^[0-9a-zA-Z]+$", code)
+	}
+}
+
+func TestObfuscatedGenerator_Snowflake(t *testing.T) {
+	snowflake, err := NewSnowflakeGenerator(3)
+	require.NoError(t, err)
+	g, err := NewObfuscatedGenerator(snowflake, testObfuscationKey)
+	require.NoError(t, err)
+
+	codes, err := g.GenerateShortCodes(1000)
+	require.NoError(t, err)
+	code, err := g.GenerateShortCode()
+	require.NoError(t, err)
+
+	seen := make(map[string]bool)
+	for _, code := range append(codes, code) {
+		assert.Len(t, code, SnowflakeCodeLength)
+		assert.Regexp(t, "^[0-9a-zA-Z]+$", code)
+		assert.False(t, seen[code], "duplicate short code %s", code)
+		seen[code] = true
+	}
+}
@@ -1,41 +1,254 @@
 package idgenerator
 
 import (
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"math"
 	"sync"
 	"time"
 )
 
 var _ IDGeneratorInterface = (*SnowflakeGenerator)(nil)
 
+// MaxMachineID is the largest machine ID that fits the 10 bits a snowflake ID reserves for it
+const MaxMachineID = 1<<10 - 1
+
+// SnowflakeCodeLength is the fewest base62 characters that hold any 63-bit snowflake ID,
+// shorter codes such as the 8 characters in the design notes only hold about 47 bits
+const SnowflakeCodeLength = 11
+
+const (
+	maxSequenceNo = 1<<12 - 1
+	// 41 bits of milliseconds, about 69 years past the epoch
+	maxTimestamp = 1<<41 - 1
+)
+
+// DefaultEpoch is the custom epoch snowflake timestamps count from, it must never move later once IDs have been issued
+var DefaultEpoch = time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// defaultMaxClockRollback is how far the clock may step back before generation fails instead of waiting
+const defaultMaxClockRollback = 100 * time.Millisecond
+
+var (
+	ErrInvalidMachineID    = fmt.Errorf("machine ID must be between 0 and %d", MaxMachineID)
+	ErrInvalidEpoch        = errors.New("snowflake epoch must be in the past 69 years")
+	ErrWorkerLeaseExpired  = errors.New("worker ID lease expired")
+	ErrClockMovedBackwards = errors.New("clock moved backwards")
+)
+
+// clock rollback counters, served with the other expvars
+var (
+	clockRollbacks        = expvar.NewInt("snowflake_clock_rollbacks")
+	clockRollbackFailures = expvar.NewInt("snowflake_clock_rollback_failures")
+)
+
 type SnowflakeGenerator struct {
 	mu            sync.Mutex
 	lastTimestamp int64
 	sequenceNo    int64
 	machineID     int64
+	codeLength    int
+
+	epoch       time.Time
+	maxRollback time.Duration
+	clock       func() time.Time
+	sleep       func(time.Duration)
+
+	// leaseUntil is when a leased machine ID may no longer be used, zero for a configured one
+	leaseUntil time.Time
+}
+
+// SnowflakeOption configures a SnowflakeGenerator
+type SnowflakeOption func(*SnowflakeGenerator)
+
+// WithEpoch counts timestamps from epoch instead of DefaultEpoch
+// moving it later repeats IDs already issued, moving it earlier only makes codes longer
+func WithEpoch(epoch time.Time) SnowflakeOption {
+	return func(g *SnowflakeGenerator) {
+		g.epoch = epoch
+	}
+}
+
+// WithMaxClockRollback sets how far the clock may step back before generation fails,
+// smaller rollbacks block generation until the clock catches up, 0 fails on any rollback
+func WithMaxClockRollback(d time.Duration) SnowflakeOption {
+	return func(g *SnowflakeGenerator) {
+		g.maxRollback = d
+	}
+}
+
+// WithShortCodeLength left pads codes with zeros to length characters instead of SnowflakeCodeLength,
+// fixed-length codes sort in the order they were generated
+func WithShortCodeLength(length int) SnowflakeOption {
+	return func(g *SnowflakeGenerator) {
+		g.codeLength = length
+	}
 }
 
-func NewSnowflakeGenerator() *SnowflakeGenerator {
-	return &SnowflakeGenerator{
-		lastTimestamp: time.Now().UnixNano(),
-		sequenceNo:    0,
-		machineID:     0,
+// WithClock replaces the wall clock, for tests
+func WithClock(clock func() time.Time) SnowflakeOption {
+	return func(g *SnowflakeGenerator) {
+		g.clock = clock
 	}
 }
 
+// NewSnowflakeGenerator creates a generator for machineID, which must be unique among running instances
+func NewSnowflakeGenerator(machineID int64, opts ...SnowflakeOption) (*SnowflakeGenerator, error) {
+	if machineID < 0 || machineID > MaxMachineID {
+		return nil, ErrInvalidMachineID
+	}
+
+	g := &SnowflakeGenerator{
+		machineID:   machineID,
+		codeLength:  SnowflakeCodeLength,
+		epoch:       DefaultEpoch,
+		maxRollback: defaultMaxClockRollback,
+		clock:       time.Now,
+		sleep:       time.Sleep,
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+
+	if g.codeLength < SnowflakeCodeLength {
+		return nil, ErrShortCodeLength
+	}
+
+	// timestamps before the epoch would make negative IDs, too long after it overflows the timestamp bits
+	if now := g.now(); now < 0 || now > maxTimestamp {
+		return nil, ErrInvalidEpoch
+	}
+
+	return g, nil
+}
+
+// MachineID returns the machine ID embedded in every generated ID
+func (g *SnowflakeGenerator) MachineID() int64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.machineID
+}
+
 func (g *SnowflakeGenerator) GenerateShortCode() (string, error) {
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
-	now := time.Now().UnixMilli()
+	if err := g.checkLease(); err != nil {
+		return "", err
+	}
+
+	id, err := g.nextID()
+	if err != nil {
+		return "", err
+	}
+	return base62Encode(id, g.codeLength), nil
+}
+
+// GenerateShortCodes generates n short codes holding the lock once for the whole batch
+func (g *SnowflakeGenerator) GenerateShortCodes(n int) ([]string, error) {
+	ids, err := g.GenerateIDs(n)
+	if err != nil {
+		return nil, err
+	}
+	return encodeAll(ids, g.codeLength), nil
+}
+
+// GenerateIDs generates n snowflake IDs holding the lock once for the whole batch
+func (g *SnowflakeGenerator) GenerateIDs(n int) ([]int64, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if err := g.checkLease(); err != nil {
+		return nil, err
+	}
+
+	ids := make([]int64, 0, n)
+	for i := 0; i < n; i++ {
+		id, err := g.nextID()
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// ShortCodeLength returns the fixed length of the generated codes
+func (g *SnowflakeGenerator) ShortCodeLength() int {
+	return g.codeLength
+}
+
+// MaxID returns the largest ID a snowflake can be, any 63-bit number
+func (g *SnowflakeGenerator) MaxID() int64 {
+	return math.MaxInt64
+}
+
+// extendLease lets a leased machine ID be used until until
+func (g *SnowflakeGenerator) extendLease(until time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.leaseUntil = until
+}
+
+// switchMachineID moves generation onto a newly leased machine ID, usable until until
+func (g *SnowflakeGenerator) switchMachineID(machineID int64, until time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.machineID = machineID
+	g.leaseUntil = until
+}
+
+// checkLease refuses to generate once a lease has run out, another instance may hold the machine ID by now
+// callers must hold g.mu
+func (g *SnowflakeGenerator) checkLease() error {
+	if !g.leaseUntil.IsZero() && g.clock().After(g.leaseUntil) {
+		return ErrWorkerLeaseExpired
+	}
+	return nil
+}
+
+// now returns milliseconds since the epoch
+func (g *SnowflakeGenerator) now() int64 {
+	return g.clock().Sub(g.epoch).Milliseconds()
+}
+
+// waitUntil blocks until the clock reaches ts and returns the time it then reads
+func (g *SnowflakeGenerator) waitUntil(ts int64) int64 {
+	now := g.now()
+	for now < ts {
+		g.sleep(time.Duration(ts-now) * time.Millisecond)
+		now = g.now()
+	}
+	return now
+}
+
+// nextID returns the next snowflake ID, callers must hold g.mu
+func (g *SnowflakeGenerator) nextID() (int64, error) {
+	now := g.now()
+
+	if now < g.lastTimestamp {
+		// NTP stepped the clock back, reusing these timestamps would repeat IDs
+		rollback := time.Duration(g.lastTimestamp-now) * time.Millisecond
+		clockRollbacks.Add(1)
+		if rollback > g.maxRollback {
+			clockRollbackFailures.Add(1)
+			log.Printf("Clock moved backwards by %v, refusing to generate IDs", rollback)
+			return 0, ErrClockMovedBackwards
+		}
+		now = g.waitUntil(g.lastTimestamp)
+	}
 
 	if now == g.lastTimestamp {
 		// same millisecond, increment sequenceID
 		g.sequenceNo++
-		if g.sequenceNo > 4095 { // 12 bits
+		if g.sequenceNo > maxSequenceNo { // 12 bits
 			// wait for next millisecond
-			for now <= g.lastTimestamp {
-				now = time.Now().UnixMilli()
-			}
+			now = g.waitUntil(g.lastTimestamp + 1)
 			g.sequenceNo = 0
 		}
 	} else {
@@ -45,23 +258,26 @@ func (g *SnowflakeGenerator) GenerateShortCode() (string, error) {
 	g.lastTimestamp = now
 
 	// Combine timestamp, machine ID, and sequence
-	id := (now << 22) | (g.machineID << 12) | g.sequenceNo
-
-	return base62Encode(id), nil
+	return (now << 22) | (g.machineID << 12) | g.sequenceNo, nil
 }
 
-// base62Encode converts a number to base62
-func base62Encode(n int64) string {
-	const charset = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
-	if n == 0 {
-		return "0"
+// encodeAll base62 encodes ids to codes of width characters
+func encodeAll(ids []int64, width int) []string {
+	codes := make([]string, len(ids))
+	for i, id := range ids {
+		codes[i] = base62Encode(id, width)
 	}
+	return codes
+}
 
-	var result []byte
+// base62Encode converts a number to base62, left padded with zeros to width characters
+func base62Encode(n int64, width int) string {
+	const charset = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
 	base := int64(len(charset))
 
-	for n > 0 {
-		result = append([]byte{charset[n%base]}, result...)
+	result := make([]byte, width)
+	for i := width - 1; i >= 0; i-- {
+		result[i] = charset[n%base]
 		n /= base
 	}
 
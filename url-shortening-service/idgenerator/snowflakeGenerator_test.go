@@ -0,0 +1,239 @@
+package idgenerator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSnowflakeGenerator(t *testing.T) {
+	tests := []struct {
+		name      string
+		machineID int64
+		wantErr   error
+	}{
+		{name: "lowest machine ID", machineID: 0},
+		{name: "highest machine ID", machineID: MaxMachineID},
+		{name: "negative machine ID", machineID: -1, wantErr: ErrInvalidMachineID},
+		{name: "machine ID over 10 bits", machineID: MaxMachineID + 1, wantErr: ErrInvalidMachineID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := NewSnowflakeGenerator(tt.machineID)
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr, err)
+				assert.Nil(t, g)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.machineID, g.MachineID())
+
+			g.mu.Lock()
+			id, err := g.nextID()
+			g.mu.Unlock()
+			require.NoError(t, err)
+			assert.Equal(t, tt.machineID, (id>>12)&MaxMachineID)
+		})
+	}
+}
+
+func TestSnowflakeGenerator_DistinctMachineIDs(t *testing.T) {
+	a, err := NewSnowflakeGenerator(1)
+	require.NoError(t, err)
+	b, err := NewSnowflakeGenerator(2)
+	require.NoError(t, err)
+
+	// two instances generating in the same millisecond only differ by machine ID
+	seen := make(map[string]bool)
+	for _, g := range []*SnowflakeGenerator{a, b} {
+		codes, err := g.GenerateShortCodes(1000)
+		require.NoError(t, err)
+		for _, code := range codes {
+			assert.False(t, seen[code], "duplicate short code %s", code)
+			seen[code] = true
+		}
+	}
+}
+
+func TestSnowflakeGenerator_ShortCodeLength(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       []SnowflakeOption
+		wantLength int
+		wantErr    error
+	}{
+		{name: "default length", wantLength: SnowflakeCodeLength},
+		{name: "padded", opts: []SnowflakeOption{WithShortCodeLength(14)}, wantLength: 14},
+		// 62^8 is about 2^47.6, too few for 63-bit IDs
+		{name: "design notes length", opts: []SnowflakeOption{WithShortCodeLength(8)}, wantErr: ErrShortCodeLength},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := NewSnowflakeGenerator(MaxMachineID, tt.opts...)
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr, err)
+				return
+			}
+			require.NoError(t, err)
+
+			codes, err := g.GenerateShortCodes(100)
+			require.NoError(t, err)
+			for _, code := range codes {
+				assert.Len(t, code, tt.wantLength)
+				assert.Regexp(t, "^[0-9a-zA-Z]+$", code)
+			}
+			// fixed-length base62 sorts like the IDs it encodes
+			assert.IsIncreasing(t, codes)
+		})
+	}
+}
+
+func TestBase62Encode(t *testing.T) {
+	tests := []struct {
+		n     int64
+		width int
+		want  string
+	}{
+		{n: 0, width: 4, want: "0000"},
+		{n: 61, width: 4, want: "000z"},
+		{n: 62, width: 4, want: "0010"},
+		{n: 1<<63 - 1, width: SnowflakeCodeLength, want: "AzL8n0Y58m7"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, base62Encode(tt.n, tt.width))
+	}
+}
+
+// fakeClock is a manually advanced clock, sleeping advances it by the slept duration
+type fakeClock struct {
+	now    time.Time
+	sleeps []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.sleeps = append(c.sleeps, d)
+	c.now = c.now.Add(d)
+}
+
+func newFakeClockGenerator(t *testing.T, clock *fakeClock, opts ...SnowflakeOption) *SnowflakeGenerator {
+	g, err := NewSnowflakeGenerator(1, append([]SnowflakeOption{WithClock(clock.Now)}, opts...)...)
+	require.NoError(t, err)
+	g.sleep = clock.Sleep
+	return g
+}
+
+func TestSnowflakeGenerator_Epoch(t *testing.T) {
+	epoch := time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+	clock := &fakeClock{now: epoch.Add(1500 * time.Millisecond)}
+
+	g := newFakeClockGenerator(t, clock, WithEpoch(epoch))
+	g.mu.Lock()
+	id, err := g.nextID()
+	g.mu.Unlock()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1500), id>>22)
+
+	// counting from 1970 spends ID space on the years before the service existed
+	unix := newFakeClockGenerator(t, clock, WithEpoch(time.Unix(0, 0)))
+	code, err := g.GenerateShortCode()
+	require.NoError(t, err)
+	unixCode, err := unix.GenerateShortCode()
+	require.NoError(t, err)
+	assert.Less(t, code, unixCode)
+
+	tests := []struct {
+		name  string
+		epoch time.Time
+	}{
+		{name: "epoch in the future", epoch: clock.now.Add(time.Second)},
+		{name: "epoch too long ago for 41 bits", epoch: clock.now.AddDate(-70, 0, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewSnowflakeGenerator(1, WithClock(clock.Now), WithEpoch(tt.epoch))
+			assert.Equal(t, ErrInvalidEpoch, err)
+		})
+	}
+}
+
+func TestSnowflakeGenerator_ClockRollback(t *testing.T) {
+	start := DefaultEpoch.Add(time.Hour)
+
+	t.Run("waits out a small rollback", func(t *testing.T) {
+		clock := &fakeClock{now: start}
+		g := newFakeClockGenerator(t, clock, WithMaxClockRollback(50*time.Millisecond))
+		rollbacks := clockRollbacks.Value()
+
+		first, err := g.GenerateShortCodes(1)
+		require.NoError(t, err)
+
+		clock.now = start.Add(-20 * time.Millisecond)
+		second, err := g.GenerateShortCodes(1)
+		require.NoError(t, err)
+
+		assert.NotEqual(t, first, second)
+		assert.Equal(t, []time.Duration{20 * time.Millisecond}, clock.sleeps)
+		assert.Equal(t, rollbacks+1, clockRollbacks.Value())
+
+		// the wait lands back on the last millisecond, so the sequence carries on instead of restarting
+		assert.Equal(t, int64(1), g.sequenceNo)
+	})
+
+	t.Run("fails on a rollback past the bound", func(t *testing.T) {
+		clock := &fakeClock{now: start}
+		g := newFakeClockGenerator(t, clock, WithMaxClockRollback(50*time.Millisecond))
+		failures := clockRollbackFailures.Value()
+
+		_, err := g.GenerateShortCode()
+		require.NoError(t, err)
+
+		clock.now = start.Add(-time.Second)
+		_, err = g.GenerateShortCode()
+		assert.Equal(t, ErrClockMovedBackwards, err)
+		_, err = g.GenerateShortCodes(5)
+		assert.Equal(t, ErrClockMovedBackwards, err)
+		assert.Empty(t, clock.sleeps)
+		assert.Equal(t, failures+2, clockRollbackFailures.Value())
+
+		// generation resumes once the clock is past the last issued timestamp
+		clock.now = start.Add(time.Millisecond)
+		_, err = g.GenerateShortCode()
+		assert.NoError(t, err)
+	})
+
+	t.Run("zero bound fails on any rollback", func(t *testing.T) {
+		clock := &fakeClock{now: start}
+		g := newFakeClockGenerator(t, clock, WithMaxClockRollback(0))
+
+		_, err := g.GenerateShortCode()
+		require.NoError(t, err)
+
+		clock.now = start.Add(-time.Millisecond)
+		_, err = g.GenerateShortCode()
+		assert.Equal(t, ErrClockMovedBackwards, err)
+	})
+}
+
+func TestSnowflakeGenerator_SequenceExhaustion(t *testing.T) {
+	clock := &fakeClock{now: DefaultEpoch.Add(time.Hour)}
+	g := newFakeClockGenerator(t, clock)
+
+	// 4096 IDs fit in one millisecond, the next one waits for the clock to tick over
+	codes, err := g.GenerateShortCodes(maxSequenceNo + 2)
+	require.NoError(t, err)
+
+	assert.Equal(t, []time.Duration{time.Millisecond}, clock.sleeps)
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		assert.False(t, seen[code], "duplicate short code %s", code)
+		seen[code] = true
+	}
+}
@@ -0,0 +1,226 @@
+package idgenerator
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"sync"
+	"time"
+)
+
+var _ IDGeneratorInterface = (*TicketGenerator)(nil)
+
+// ticket server: IDs are sequential numbers leased from a shared counter a block at a time,
+// so only one database call is made per block and codes are as short as the number of links allows
+// tickets left in a block when the process stops are never issued, so the sequence has gaps
+
+// DefaultTicketBlockSize is how many tickets are leased at a time
+const DefaultTicketBlockSize = 1000
+
+// ticketLeaseTimeout bounds a single block lease
+const ticketLeaseTimeout = 5 * time.Second
+
+var (
+	ErrIDSpaceExhausted = errors.New("every short code of the configured length has been issued")
+	ErrInvalidBlockSize = errors.New("ticket block size must be positive")
+)
+
+// TicketLeaser hands out blocks of sequential tickets, implemented by the repository
+type TicketLeaser interface {
+	// LeaseTickets reserves n tickets and returns the first, the block is [first, first+n)
+	LeaseTickets(ctx context.Context, n int64) (int64, error)
+}
+
+// ticketBlock is a leased range of tickets, next is the first one not yet issued
+type ticketBlock struct {
+	next int64
+	end  int64
+}
+
+func (b ticketBlock) remaining() int64 {
+	return b.end - b.next
+}
+
+type TicketGenerator struct {
+	leaser     TicketLeaser
+	codeLength int
+	maxID      int64
+	blockSize  int64
+
+	mu    sync.Mutex
+	block ticketBlock
+	// spare is the block leased ahead of time, used once block runs out
+	spare *ticketBlock
+	// refilling is closed when the running background lease finishes, nil when none is running
+	refilling chan struct{}
+	refillErr error
+}
+
+// TicketOption configures a TicketGenerator
+type TicketOption func(*TicketGenerator)
+
+// WithBlockSize leases n tickets at a time instead of DefaultTicketBlockSize
+func WithBlockSize(n int64) TicketOption {
+	return func(g *TicketGenerator) {
+		g.blockSize = n
+	}
+}
+
+// NewTicketGenerator creates a generator for codes of codeLength characters, leasing its first block straight away
+// so a missing ticket table fails startup rather than the first shorten request
+func NewTicketGenerator(ctx context.Context, leaser TicketLeaser, codeLength int, opts ...TicketOption) (*TicketGenerator, error) {
+	if codeLength < 1 {
+		return nil, ErrShortCodeLength
+	}
+
+	g := &TicketGenerator{
+		leaser:     leaser,
+		codeLength: codeLength,
+		maxID:      maxBase62(codeLength),
+		blockSize:  DefaultTicketBlockSize,
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+
+	if g.blockSize < 1 {
+		return nil, ErrInvalidBlockSize
+	}
+
+	first, err := leaser.LeaseTickets(ctx, g.blockSize)
+	if err != nil {
+		return nil, err
+	}
+	if first > g.maxID {
+		return nil, ErrIDSpaceExhausted
+	}
+	g.block = ticketBlock{next: first, end: first + g.blockSize}
+
+	return g, nil
+}
+
+func (g *TicketGenerator) GenerateShortCode() (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	id, err := g.nextID()
+	if err != nil {
+		return "", err
+	}
+	return base62Encode(id, g.codeLength), nil
+}
+
+// GenerateShortCodes generates n short codes holding the lock for the whole batch, so they're consecutive
+// where the block allows
+func (g *TicketGenerator) GenerateShortCodes(n int) ([]string, error) {
+	ids, err := g.GenerateIDs(n)
+	if err != nil {
+		return nil, err
+	}
+	return encodeAll(ids, g.codeLength), nil
+}
+
+// GenerateIDs issues n tickets holding the lock for the whole batch
+func (g *TicketGenerator) GenerateIDs(n int) ([]int64, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ids := make([]int64, 0, n)
+	for i := 0; i < n; i++ {
+		id, err := g.nextID()
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// ShortCodeLength returns the fixed length of the generated codes
+func (g *TicketGenerator) ShortCodeLength() int {
+	return g.codeLength
+}
+
+// MaxID returns the last ticket that fits the code length
+func (g *TicketGenerator) MaxID() int64 {
+	return g.maxID
+}
+
+// nextID issues the next ticket, callers must hold g.mu
+// only blocks when the spare block hasn't arrived by the time the current one runs out
+func (g *TicketGenerator) nextID() (int64, error) {
+	for g.block.remaining() <= 0 {
+		if g.spare != nil {
+			g.block = *g.spare
+			g.spare = nil
+			continue
+		}
+
+		if g.refilling == nil {
+			g.startRefill()
+		}
+		done := g.refilling
+
+		g.mu.Unlock()
+		<-done
+		g.mu.Lock()
+
+		if g.spare == nil && g.refillErr != nil {
+			return 0, g.refillErr
+		}
+	}
+
+	id := g.block.next
+	if id > g.maxID {
+		return 0, ErrIDSpaceExhausted
+	}
+	g.block.next++
+
+	// lease the next block once a fifth of this one is left, so it's normally in place before it's needed
+	if g.block.remaining() <= g.blockSize/5 && g.spare == nil && g.refilling == nil {
+		g.startRefill()
+	}
+
+	return id, nil
+}
+
+// startRefill leases the spare block in the background, callers must hold g.mu
+func (g *TicketGenerator) startRefill() {
+	done := make(chan struct{})
+	g.refilling = done
+	g.refillErr = nil
+
+	go func() {
+		// bounded so a hung database can't leave the refill running forever
+		ctx, cancel := context.WithTimeout(context.Background(), ticketLeaseTimeout)
+		defer cancel()
+
+		first, err := g.leaser.LeaseTickets(ctx, g.blockSize)
+
+		g.mu.Lock()
+		defer g.mu.Unlock()
+
+		if err != nil {
+			// the next ticket that finds the block empty tries again
+			log.Printf("Failed to lease ticket block: %v", err)
+			g.refillErr = err
+		} else {
+			g.spare = &ticketBlock{next: first, end: first + g.blockSize}
+		}
+		g.refilling = nil
+		close(done)
+	}()
+}
+
+// maxBase62 returns the largest number length base62 characters can hold, capped at the largest int64
+func maxBase62(length int) int64 {
+	limit := int64(1)
+	for i := 0; i < length; i++ {
+		if limit > math.MaxInt64/62 {
+			return math.MaxInt64
+		}
+		limit *= 62
+	}
+	return limit - 1
+}
@@ -0,0 +1,188 @@
+package idgenerator
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTicketLeaser is an in-memory TicketLeaser, a non-nil gate holds each lease until it's sent to
+type fakeTicketLeaser struct {
+	mu     sync.Mutex
+	next   int64
+	leases int
+	err    error
+	gate   chan struct{}
+}
+
+func (f *fakeTicketLeaser) LeaseTickets(ctx context.Context, n int64) (int64, error) {
+	if f.gate != nil {
+		<-f.gate
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.leases++
+	if f.err != nil {
+		return 0, f.err
+	}
+	first := f.next
+	f.next += n
+	return first, nil
+}
+
+func (f *fakeTicketLeaser) leaseCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.leases
+}
+
+func (f *fakeTicketLeaser) setErr(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = err
+}
+
+func TestNewTicketGenerator(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name       string
+		leaser     *fakeTicketLeaser
+		codeLength int
+		opts       []TicketOption
+		wantErr    error
+	}{
+		{name: "leases first block", leaser: &fakeTicketLeaser{}, codeLength: 8},
+		{name: "zero length", leaser: &fakeTicketLeaser{}, codeLength: 0, wantErr: ErrShortCodeLength},
+		{name: "zero block size", leaser: &fakeTicketLeaser{}, codeLength: 8, opts: []TicketOption{WithBlockSize(0)}, wantErr: ErrInvalidBlockSize},
+		{name: "lease fails", leaser: &fakeTicketLeaser{err: errors.New("table doesn't exist")}, codeLength: 8, wantErr: errors.New("table doesn't exist")},
+		// 62^2 codes of two characters
+		{name: "counter past the code length", leaser: &fakeTicketLeaser{next: 62 * 62}, codeLength: 2, wantErr: ErrIDSpaceExhausted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := NewTicketGenerator(ctx, tt.leaser, tt.codeLength, tt.opts...)
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr, err)
+				assert.Nil(t, g)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, 1, tt.leaser.leaseCount())
+		})
+	}
+}
+
+func TestTicketGenerator_Sequential(t *testing.T) {
+	leaser := &fakeTicketLeaser{next: 1}
+	g, err := NewTicketGenerator(context.Background(), leaser, 8, WithBlockSize(10))
+	require.NoError(t, err)
+
+	code, err := g.GenerateShortCode()
+	require.NoError(t, err)
+	assert.Equal(t, "00000001", code)
+
+	codes, err := g.GenerateShortCodes(60)
+	require.NoError(t, err)
+	assert.Equal(t, "00000002", codes[0])
+	assert.Equal(t, "0000000z", codes[59])
+	assert.IsIncreasing(t, codes)
+
+	// 61 tickets from blocks of 10, plus at most the spare leased ahead
+	assert.LessOrEqual(t, leaser.leaseCount(), 8)
+}
+
+func TestTicketGenerator_RefillsInBackground(t *testing.T) {
+	leaser := &fakeTicketLeaser{}
+	g, err := NewTicketGenerator(context.Background(), leaser, 8, WithBlockSize(10))
+	require.NoError(t, err)
+
+	// the next lease blocks until the gate opens
+	leaser.gate = make(chan struct{})
+
+	// 8 of 10 used leaves a fifth, which starts the refill without waiting for it
+	_, err = g.GenerateShortCodes(8)
+	require.NoError(t, err)
+	assert.Equal(t, 1, leaser.leaseCount())
+
+	// the rest of the block is still handed out while the refill is pending
+	_, err = g.GenerateShortCodes(2)
+	require.NoError(t, err)
+
+	leaser.gate <- struct{}{}
+	require.Eventually(t, func() bool { return leaser.leaseCount() == 2 }, time.Second, time.Millisecond)
+
+	code, err := g.GenerateShortCode()
+	require.NoError(t, err)
+	assert.Equal(t, "0000000A", code)
+}
+
+func TestTicketGenerator_RefillFailure(t *testing.T) {
+	leaser := &fakeTicketLeaser{}
+	g, err := NewTicketGenerator(context.Background(), leaser, 8, WithBlockSize(5))
+	require.NoError(t, err)
+
+	leaser.setErr(errors.New("database connection lost"))
+
+	_, err = g.GenerateShortCodes(5)
+	require.NoError(t, err)
+
+	// the background refill failed, so the next code retries the lease and reports its error
+	_, err = g.GenerateShortCode()
+	assert.EqualError(t, err, "database connection lost")
+
+	leaser.setErr(nil)
+	code, err := g.GenerateShortCode()
+	require.NoError(t, err)
+	assert.Equal(t, "00000005", code)
+}
+
+func TestTicketGenerator_IDSpaceExhausted(t *testing.T) {
+	leaser := &fakeTicketLeaser{next: 62 - 3}
+	g, err := NewTicketGenerator(context.Background(), leaser, 1, WithBlockSize(10))
+	require.NoError(t, err)
+
+	codes, err := g.GenerateShortCodes(3)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"x", "y", "z"}, codes)
+
+	_, err = g.GenerateShortCode()
+	assert.Equal(t, ErrIDSpaceExhausted, err)
+}
+
+func TestTicketGenerator_Concurrent(t *testing.T) {
+	leaser := &fakeTicketLeaser{}
+	g, err := NewTicketGenerator(context.Background(), leaser, 8, WithBlockSize(7))
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	seen := make(map[string]bool)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				code, err := g.GenerateShortCode()
+				if !assert.NoError(t, err) {
+					return
+				}
+				mu.Lock()
+				assert.False(t, seen[code], "duplicate short code %s", code)
+				seen[code] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, seen, 800)
+}
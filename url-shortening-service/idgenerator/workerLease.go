@@ -0,0 +1,137 @@
+package idgenerator
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// leased machine IDs: instead of configuring a unique machine ID per replica, each instance claims a free one
+// from a shared lease table, renews it with a heartbeat and releases it on shutdown
+// an instance that can't renew stops generating once its lease runs out, as another may have claimed the ID,
+// and one whose ID has been claimed by another instance leases a new one
+
+// ErrWorkerLeaseLost is returned by a WorkerLeaser when owner no longer holds the machine ID
+var ErrWorkerLeaseLost = errors.New("worker ID lease lost")
+
+// WorkerLeaser hands out machine IDs leased for a TTL, implemented by the repository
+type WorkerLeaser interface {
+	// AcquireWorkerID claims a free or expired machine ID for owner
+	AcquireWorkerID(ctx context.Context, owner string, ttl time.Duration) (int64, error)
+	// RenewWorkerID extends owner's lease on workerID, returning ErrWorkerLeaseLost if owner no longer holds it
+	RenewWorkerID(ctx context.Context, workerID int64, owner string, ttl time.Duration) error
+	// ReleaseWorkerID frees workerID if owner still holds it
+	ReleaseWorkerID(ctx context.Context, workerID int64, owner string) error
+}
+
+// WorkerLease keeps a leased machine ID renewed for a SnowflakeGenerator
+type WorkerLease struct {
+	leaser    WorkerLeaser
+	owner     string
+	ttl       time.Duration
+	generator *SnowflakeGenerator
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// LeaseSnowflakeGenerator claims a machine ID through leaser and returns a generator using it,
+// the lease is renewed every third of ttl until Close
+func LeaseSnowflakeGenerator(ctx context.Context, leaser WorkerLeaser, owner string, ttl time.Duration, opts ...SnowflakeOption) (*SnowflakeGenerator, *WorkerLease, error) {
+	// the lease is counted from before the claim, so this instance never thinks it holds it longer than the table does
+	start := time.Now()
+	workerID, err := leaser.AcquireWorkerID(ctx, owner, ttl)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	generator, err := NewSnowflakeGenerator(workerID, opts...)
+	if err != nil {
+		// don't hold an ID nothing will renew
+		leaser.ReleaseWorkerID(ctx, workerID, owner)
+		return nil, nil, err
+	}
+	generator.extendLease(start.Add(ttl))
+
+	lease := &WorkerLease{
+		leaser:    leaser,
+		owner:     owner,
+		ttl:       ttl,
+		generator: generator,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go lease.heartbeat()
+
+	return generator, lease, nil
+}
+
+// heartbeat renews the lease until Close
+func (l *WorkerLease) heartbeat() {
+	defer close(l.done)
+
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			l.renew()
+		}
+	}
+}
+
+func (l *WorkerLease) renew() {
+	ctx, cancel := context.WithTimeout(context.Background(), l.ttl/3)
+	defer cancel()
+
+	start := time.Now()
+	workerID := l.generator.MachineID()
+	err := l.leaser.RenewWorkerID(ctx, workerID, l.owner, l.ttl)
+	if err == ErrWorkerLeaseLost {
+		l.reacquire(ctx, workerID)
+		return
+	}
+	if err != nil {
+		// keep the current expiry, the next heartbeat retries
+		log.Printf("Failed to renew lease on worker ID %d: %v", workerID, err)
+		return
+	}
+	l.generator.extendLease(start.Add(l.ttl))
+}
+
+// reacquire leases a new machine ID once another instance has claimed lostID, renewing it can never succeed again
+// if no ID is free the generator stays stopped and the next heartbeat tries again
+func (l *WorkerLease) reacquire(ctx context.Context, lostID int64) {
+	log.Printf("Lost lease on worker ID %d, leasing another", lostID)
+	l.generator.extendLease(time.Now())
+
+	start := time.Now()
+	workerID, err := l.leaser.AcquireWorkerID(ctx, l.owner, l.ttl)
+	if err != nil {
+		log.Printf("Failed to lease a new worker ID: %v", err)
+		return
+	}
+
+	l.generator.switchMachineID(workerID, start.Add(l.ttl))
+	log.Printf("Leased worker ID %d", workerID)
+}
+
+// Close stops renewing and releases the machine ID
+func (l *WorkerLease) Close(ctx context.Context) error {
+	var err error
+	l.closeOnce.Do(func() {
+		close(l.stop)
+		<-l.done
+
+		// stop generating before another instance can claim the ID
+		l.generator.extendLease(time.Now())
+		err = l.leaser.ReleaseWorkerID(ctx, l.generator.MachineID(), l.owner)
+	})
+	return err
+}
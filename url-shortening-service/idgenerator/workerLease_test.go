@@ -0,0 +1,162 @@
+package idgenerator
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeLeaser is an in-memory WorkerLeaser
+type fakeLeaser struct {
+	mu       sync.Mutex
+	owners   map[int64]string
+	renewals int
+	renewErr error
+}
+
+func newFakeLeaser() *fakeLeaser {
+	return &fakeLeaser{owners: make(map[int64]string)}
+}
+
+func (f *fakeLeaser) AcquireWorkerID(ctx context.Context, owner string, ttl time.Duration) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for id := int64(0); id <= MaxMachineID; id++ {
+		if _, taken := f.owners[id]; !taken {
+			f.owners[id] = owner
+			return id, nil
+		}
+	}
+	return 0, errors.New("no free worker ID")
+}
+
+func (f *fakeLeaser) RenewWorkerID(ctx context.Context, workerID int64, owner string, ttl time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.renewals++
+	if f.renewErr != nil {
+		return f.renewErr
+	}
+	if f.owners[workerID] != owner {
+		return ErrWorkerLeaseLost
+	}
+	return nil
+}
+
+func (f *fakeLeaser) ReleaseWorkerID(ctx context.Context, workerID int64, owner string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.owners[workerID] != owner {
+		return errors.New("lease lost")
+	}
+	delete(f.owners, workerID)
+	return nil
+}
+
+// steal hands workerID to another owner, as if its lease had lapsed and another instance claimed it
+func (f *fakeLeaser) steal(workerID int64, owner string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.owners[workerID] = owner
+}
+
+func (f *fakeLeaser) owner(workerID int64) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.owners[workerID]
+}
+
+func (f *fakeLeaser) renewCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.renewals
+}
+
+func TestLeaseSnowflakeGenerator(t *testing.T) {
+	ctx := context.Background()
+	leaser := newFakeLeaser()
+
+	a, leaseA, err := LeaseSnowflakeGenerator(ctx, leaser, "a", time.Minute)
+	require.NoError(t, err)
+	b, leaseB, err := LeaseSnowflakeGenerator(ctx, leaser, "b", time.Minute)
+	require.NoError(t, err)
+
+	assert.NotEqual(t, a.MachineID(), b.MachineID())
+
+	_, err = a.GenerateShortCode()
+	assert.NoError(t, err)
+
+	// closing releases the ID for the next instance and stops generating with it
+	require.NoError(t, leaseA.Close(ctx))
+	_, err = a.GenerateShortCode()
+	assert.Equal(t, ErrWorkerLeaseExpired, err)
+
+	c, leaseC, err := LeaseSnowflakeGenerator(ctx, leaser, "c", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, a.MachineID(), c.MachineID())
+
+	require.NoError(t, leaseB.Close(ctx))
+	require.NoError(t, leaseC.Close(ctx))
+	// closing twice doesn't release again
+	assert.NoError(t, leaseC.Close(ctx))
+}
+
+func TestWorkerLease_Heartbeat(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("renewals keep the generator usable", func(t *testing.T) {
+		leaser := newFakeLeaser()
+		g, lease, err := LeaseSnowflakeGenerator(ctx, leaser, "a", 60*time.Millisecond)
+		require.NoError(t, err)
+		defer lease.Close(ctx)
+
+		time.Sleep(150 * time.Millisecond)
+
+		assert.GreaterOrEqual(t, leaser.renewCount(), 2)
+		_, err = g.GenerateShortCode()
+		assert.NoError(t, err)
+	})
+
+	t.Run("failed renewals expire the lease", func(t *testing.T) {
+		leaser := newFakeLeaser()
+		leaser.renewErr = errors.New("database connection lost")
+		g, lease, err := LeaseSnowflakeGenerator(ctx, leaser, "a", 60*time.Millisecond)
+		require.NoError(t, err)
+		defer lease.Close(ctx)
+
+		time.Sleep(100 * time.Millisecond)
+
+		_, err = g.GenerateShortCode()
+		assert.Equal(t, ErrWorkerLeaseExpired, err)
+		_, err = g.GenerateShortCodes(10)
+		assert.Equal(t, ErrWorkerLeaseExpired, err)
+	})
+
+	t.Run("lost lease is replaced with a new worker ID", func(t *testing.T) {
+		leaser := newFakeLeaser()
+		g, lease, err := LeaseSnowflakeGenerator(ctx, leaser, "a", 60*time.Millisecond)
+		require.NoError(t, err)
+
+		lost := g.MachineID()
+		leaser.steal(lost, "b")
+		time.Sleep(100 * time.Millisecond)
+
+		assert.NotEqual(t, lost, g.MachineID())
+		assert.Equal(t, "a", leaser.owner(g.MachineID()))
+		_, err = g.GenerateShortCode()
+		assert.NoError(t, err)
+
+		// the new ID is the one released
+		require.NoError(t, lease.Close(ctx))
+		assert.Equal(t, "b", leaser.owner(lost))
+		assert.Equal(t, "", leaser.owner(g.MachineID()))
+	})
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"log"
 
 	"github.com/oyinetare/url-shortener/config"
@@ -12,6 +13,10 @@ func main() {
 	// load config
 	cfg := config.LoadConfig()
 
+	// the flag overrides SHORT_CODE_LENGTH
+	flag.IntVar(&cfg.ShortCodeLength, "shortCode", cfg.ShortCodeLength, "Length of the short code")
+	flag.Parse()
+
 	// connect to db
 	repo, err := repository.Connect(
 		cfg.DB.Host,
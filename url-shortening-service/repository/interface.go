@@ -3,6 +3,9 @@ package repository
 import (
 	"context"
 	"errors"
+	"time"
+
+	"github.com/oyinetare/url-shortener/idgenerator"
 )
 
 // Custom static errors for better error handling
@@ -10,6 +13,9 @@ var (
 	ErrURLNotFound        = errors.New("url not found")
 	ErrDuplicateShortCode = errors.New("short code already exists")
 	ErrInvalidURL         = errors.New("invalid url")
+	ErrNoFreeWorkerID     = errors.New("no free worker ID")
+	ErrWorkerLeaseLost    = idgenerator.ErrWorkerLeaseLost
+	ErrTicketsNotSeeded   = errors.New("ticket counter row missing")
 )
 
 // Constants for MySQL Error Numbers
@@ -21,19 +27,34 @@ const (
 
 // URLs represents a URL mapping
 type URLs struct {
-	ID        int64  `json:"id,omitempty"`
-	ShortURL  string `json:"shortUrl"`
-	LongURL   string `json:"longUrl"`
-	CreatedAt string `json:"createdAt,omitempty"`
-	Clicks    int    `json:"clicks,omitempty"`
+	ID          int64      `json:"id,omitempty"`
+	ShortURL    string     `json:"shortUrl"`
+	LongURL     string     `json:"longUrl"`
+	CreatedAt   string     `json:"createdAt,omitempty"`
+	Clicks      int        `json:"clicks,omitempty"`
+	LastClicked *time.Time `json:"lastClicked,omitempty"`
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty"`
+	Disabled    bool       `json:"disabled,omitempty"`
+}
+
+// IsExpired reports whether the mapping has an expiry that has passed
+func (u *URLs) IsExpired(now time.Time) bool {
+	return u.ExpiresAt != nil && !now.Before(*u.ExpiresAt)
 }
 
 // RepositoryInterface defines the contract for URL storage
+// Deleted mappings are soft-deleted, so lookups treat them as not found but their short codes are never reused
 // Also so Repository can be used in tests with dependency injection
 type RepositoryInterface interface {
-	SaveUrls(ctx context.Context, shortUrl, longUrl string) error
+	SaveUrls(ctx context.Context, shortUrl, longUrl string, expiresAt *time.Time) error
+	SaveUrlsBatch(ctx context.Context, urls []URLs) ([]error, error)
 	GetShortURLFromLong(ctx context.Context, longUrl string) (*URLs, error)
 	GetLongURLFromShort(ctx context.Context, shortUrl string) (*URLs, error)
 	IncrementClicks(ctx context.Context, shortUrl string) error
+	GetStats(ctx context.Context, shortUrl string) (*URLs, error)
+	GetTopURLs(ctx context.Context, limit int) ([]URLs, error)
+	UpdateLongURL(ctx context.Context, shortUrl, longUrl string) error
+	SetDisabled(ctx context.Context, shortUrl string, disabled bool) error
+	DeleteUrls(ctx context.Context, shortUrl string) error
 	Disconnect() error
 }
@@ -19,7 +19,8 @@ type Repository struct {
 // Connect creates a new repository connection
 func Connect(host, database, user, password string, port int) (*Repository, error) {
 	// Data Source Name - "connection string" to describe exactly how to reach and authenticate in mysql db
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?parseTime=true", user, password, host, port, database)
+	// clientFoundRows makes an UPDATE that matches a row but changes nothing still report it as affected
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?parseTime=true&clientFoundRows=true", user, password, host, port, database)
 	db, err := sql.Open("mysql", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
@@ -49,15 +50,15 @@ func Connect(host, database, user, password string, port int) (*Repository, erro
 	return &Repository{db: db}, nil
 }
 
-// SaveUrls saves a new URL mapping
-func (r *Repository) SaveUrls(ctx context.Context, shortUrl, longUrl string) error {
+// SaveUrls saves a new URL mapping, a nil expiresAt means the mapping never expires
+func (r *Repository) SaveUrls(ctx context.Context, shortUrl, longUrl string, expiresAt *time.Time) error {
 	// using prepared statements - https://go.dev/doc/database/prepared-statements
 	query := `
-		INSERT INTO urls (shortUrl, longUrl, createdAt, clicks)
-		VALUES (?, ?, NOW(), 0)
+		INSERT INTO urls (shortUrl, longUrl, createdAt, clicks, expiresAt)
+		VALUES (?, ?, NOW(), 0, ?)
 	`
 
-	_, err := r.db.ExecContext(ctx, query, shortUrl, longUrl)
+	_, err := r.db.ExecContext(ctx, query, shortUrl, longUrl, nullTime(expiresAt))
 
 	if err != nil {
 		// Check for duplicate key error
@@ -71,19 +72,67 @@ func (r *Repository) SaveUrls(ctx context.Context, shortUrl, longUrl string) err
 	return nil
 }
 
-// GetShortURLFromLong retrieves a short URL by its long URL
+// SaveUrlsBatch saves many URL mappings in a single transaction
+// The returned slice holds a per-item error (ErrDuplicateShortCode) aligned with urls,
+// a non-nil error means the transaction was rolled back and nothing was saved
+func (r *Repository) SaveUrlsBatch(ctx context.Context, urls []URLs) ([]error, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	// no-op once committed
+	defer tx.Rollback()
+
+	// using prepared statements - https://go.dev/doc/database/prepared-statements
+	// prepared once and reused for every row in the batch
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO urls (shortUrl, longUrl, createdAt, clicks, expiresAt)
+		VALUES (?, ?, NOW(), 0, ?)
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare batch insert: %w", err)
+	}
+	defer stmt.Close()
+
+	itemErrs := make([]error, len(urls))
+	for i, u := range urls {
+		_, err := stmt.ExecContext(ctx, u.ShortURL, u.LongURL, nullTime(u.ExpiresAt))
+		if err == nil {
+			continue
+		}
+
+		// InnoDB only rolls back the failing statement on a duplicate key, so the rest of the batch can carry on
+		if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == MySQLDuplicateEntry {
+			itemErrs[i] = ErrDuplicateShortCode
+			continue
+		}
+		return nil, fmt.Errorf("failed to save URL batch: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit URL batch: %w", err)
+	}
+
+	return itemErrs, nil
+}
+
+// GetShortURLFromLong retrieves the unexpired, enabled short URL of a long URL that lives longest,
+// a link that never expires first
 func (r *Repository) GetShortURLFromLong(ctx context.Context, longUrl string) (*URLs, error) {
 	// using prepared statements - https://go.dev/doc/database/prepared-statements
 	// to prevent SQL Injection, improve performance & Type Safety
 	var urls URLs
+	var expiresAt sql.NullTime
 	query := `
-		SELECT id, shortUrl, longUrl
+		SELECT id, shortUrl, longUrl, expiresAt
 		FROM urls
-		WHERE longUrl = ?
+		WHERE longUrl = ? AND (expiresAt IS NULL OR expiresAt > NOW())
+			AND NOT disabled AND deletedAt IS NULL
+		ORDER BY expiresAt IS NULL DESC, expiresAt DESC
 		LIMIT 1
 	`
 
-	err := r.db.QueryRowContext(ctx, query, longUrl).Scan(&urls.ID, &urls.ShortURL, &urls.LongURL)
+	err := r.db.QueryRowContext(ctx, query, longUrl).Scan(&urls.ID, &urls.ShortURL, &urls.LongURL, &expiresAt)
 
 	if err == sql.ErrNoRows {
 		return nil, ErrURLNotFound
@@ -93,6 +142,7 @@ func (r *Repository) GetShortURLFromLong(ctx context.Context, longUrl string) (*
 		return nil, fmt.Errorf("failed to get short URL: %w", err)
 	}
 
+	urls.ExpiresAt = timePtr(expiresAt)
 	return &urls, nil
 }
 
@@ -101,14 +151,15 @@ func (r *Repository) GetLongURLFromShort(ctx context.Context, shortUrl string) (
 	// using prepared statements - https://go.dev/doc/database/prepared-statements
 	// to prevent SQL Injection, improve performance & Type Safety
 	var urls URLs
+	var expiresAt sql.NullTime
 	query := `
-		SELECT id, shortUrl, longUrl
+		SELECT id, shortUrl, longUrl, expiresAt, disabled
 		FROM urls
-		WHERE shortUrl = ?
+		WHERE shortUrl = ? AND deletedAt IS NULL
 		LIMIT 1
 	`
 
-	err := r.db.QueryRowContext(ctx, query, shortUrl).Scan(&urls.ID, &urls.ShortURL, &urls.LongURL)
+	err := r.db.QueryRowContext(ctx, query, shortUrl).Scan(&urls.ID, &urls.ShortURL, &urls.LongURL, &expiresAt, &urls.Disabled)
 
 	if err == sql.ErrNoRows {
 		return nil, ErrURLNotFound
@@ -118,14 +169,15 @@ func (r *Repository) GetLongURLFromShort(ctx context.Context, shortUrl string) (
 		return nil, fmt.Errorf("failed to get short URL: %w", err)
 	}
 
+	urls.ExpiresAt = timePtr(expiresAt)
 	return &urls, nil
 }
 
-// IncrementClicks increments the click count for a short URL
+// IncrementClicks increments the click count and records the click time for a short URL
 func (r *Repository) IncrementClicks(ctx context.Context, shortUrl string) error {
 	// using prepared statements - https://go.dev/doc/database/prepared-statements
 	// to prevent SQL Injection, improve performance & Type Safety
-	query := `UPDATE urls SET clicks = clicks + 1 WHERE shortUrl = ?`
+	query := `UPDATE urls SET clicks = clicks + 1, lastClicked = NOW() WHERE shortUrl = ?`
 	result, err := r.db.ExecContext(ctx, query, shortUrl)
 
 	if err != nil {
@@ -144,7 +196,139 @@ func (r *Repository) IncrementClicks(ctx context.Context, shortUrl string) error
 	return nil
 }
 
+// GetStats retrieves a URL mapping together with its click statistics
+func (r *Repository) GetStats(ctx context.Context, shortUrl string) (*URLs, error) {
+	// using prepared statements - https://go.dev/doc/database/prepared-statements
+	// to prevent SQL Injection, improve performance & Type Safety
+	var urls URLs
+	var lastClicked, expiresAt sql.NullTime
+	query := `
+		SELECT id, shortUrl, longUrl, createdAt, clicks, lastClicked, expiresAt, disabled
+		FROM urls
+		WHERE shortUrl = ? AND deletedAt IS NULL
+		LIMIT 1
+	`
+
+	err := r.db.QueryRowContext(ctx, query, shortUrl).Scan(
+		&urls.ID, &urls.ShortURL, &urls.LongURL, &urls.CreatedAt, &urls.Clicks, &lastClicked, &expiresAt, &urls.Disabled,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrURLNotFound
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get URL stats: %w", err)
+	}
+
+	urls.LastClicked = timePtr(lastClicked)
+	urls.ExpiresAt = timePtr(expiresAt)
+	return &urls, nil
+}
+
+// GetTopURLs returns up to limit live links, most clicked first and most recently clicked among ties
+func (r *Repository) GetTopURLs(ctx context.Context, limit int) ([]URLs, error) {
+	query := `
+		SELECT id, shortUrl, longUrl, expiresAt
+		FROM urls
+		WHERE (expiresAt IS NULL OR expiresAt > NOW()) AND NOT disabled AND deletedAt IS NULL
+		ORDER BY clicks DESC, lastClicked DESC
+		LIMIT ?
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get top URLs: %w", err)
+	}
+	defer rows.Close()
+
+	var urls []URLs
+	for rows.Next() {
+		var url URLs
+		var expiresAt sql.NullTime
+		if err := rows.Scan(&url.ID, &url.ShortURL, &url.LongURL, &expiresAt); err != nil {
+			return nil, fmt.Errorf("failed to scan top URL: %w", err)
+		}
+		url.ExpiresAt = timePtr(expiresAt)
+		urls = append(urls, url)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get top URLs: %w", err)
+	}
+
+	return urls, nil
+}
+
+// UpdateLongURL changes the destination of an existing short URL
+func (r *Repository) UpdateLongURL(ctx context.Context, shortUrl, longUrl string) error {
+	query := `UPDATE urls SET longUrl = ? WHERE shortUrl = ? AND deletedAt IS NULL`
+	err := r.execOnShortUrl(ctx, query, longUrl, shortUrl)
+	if err != nil && err != ErrURLNotFound {
+		return fmt.Errorf("failed to update long URL: %w", err)
+	}
+	return err
+}
+
+// SetDisabled enables or disables redirects for a short URL without removing it
+func (r *Repository) SetDisabled(ctx context.Context, shortUrl string, disabled bool) error {
+	query := `UPDATE urls SET disabled = ? WHERE shortUrl = ? AND deletedAt IS NULL`
+	err := r.execOnShortUrl(ctx, query, disabled, shortUrl)
+	if err != nil && err != ErrURLNotFound {
+		return fmt.Errorf("failed to set disabled: %w", err)
+	}
+	return err
+}
+
+// DeleteUrls soft-deletes a short URL, the row is kept so its short code is never handed out again
+func (r *Repository) DeleteUrls(ctx context.Context, shortUrl string) error {
+	query := `UPDATE urls SET deletedAt = NOW() WHERE shortUrl = ? AND deletedAt IS NULL`
+	err := r.execOnShortUrl(ctx, query, shortUrl)
+	if err != nil && err != ErrURLNotFound {
+		return fmt.Errorf("failed to delete URL: %w", err)
+	}
+	return err
+}
+
+// execOnShortUrl runs a statement expected to touch exactly one row,
+// returning ErrURLNotFound when no row matched
+func (r *Repository) execOnShortUrl(ctx context.Context, query string, args ...interface{}) error {
+	// using prepared statements - https://go.dev/doc/database/prepared-statements
+	// to prevent SQL Injection, improve performance & Type Safety
+	result, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrURLNotFound
+	}
+
+	return nil
+}
+
 // Disconnect closes the database connection
 func (r *Repository) Disconnect() error {
 	return r.db.Close()
 }
+
+// nullTime converts an optional time into a value for a nullable column
+func nullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: *t, Valid: true}
+}
+
+// timePtr converts a nullable column back into an optional time
+func timePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/go-sql-driver/mysql"
@@ -50,11 +51,13 @@ func TestRepository_SaveUrls(t *testing.T) {
 
 	repo := &Repository{db: db}
 	ctx := context.Background()
+	expiresAt := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
 
 	tests := []struct {
 		name      string
 		shortURL  string
 		longURL   string
+		expiresAt *time.Time
 		mockSetup func()
 		wantErr   error
 	}{
@@ -64,7 +67,19 @@ func TestRepository_SaveUrls(t *testing.T) {
 			longURL:  "https://example.com",
 			mockSetup: func() {
 				mock.ExpectExec("INSERT INTO urls").
-					WithArgs("abc123", "https://example.com").
+					WithArgs("abc123", "https://example.com", nil).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+			wantErr: nil,
+		},
+		{
+			name:      "successful save with expiry",
+			shortURL:  "abc123",
+			longURL:   "https://example.com",
+			expiresAt: &expiresAt,
+			mockSetup: func() {
+				mock.ExpectExec("INSERT INTO urls").
+					WithArgs("abc123", "https://example.com", expiresAt).
 					WillReturnResult(sqlmock.NewResult(1, 1))
 			},
 			wantErr: nil,
@@ -75,7 +90,7 @@ func TestRepository_SaveUrls(t *testing.T) {
 			longURL:  "https://example.com",
 			mockSetup: func() {
 				mock.ExpectExec("INSERT INTO urls").
-					WithArgs("abc123", "https://example.com").
+					WithArgs("abc123", "https://example.com", nil).
 					WillReturnError(&mysql.MySQLError{Number: 1062})
 			},
 			wantErr: ErrDuplicateShortCode,
@@ -85,7 +100,7 @@ func TestRepository_SaveUrls(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			tt.mockSetup()
-			err := repo.SaveUrls(ctx, tt.shortURL, tt.longURL)
+			err := repo.SaveUrls(ctx, tt.shortURL, tt.longURL, tt.expiresAt)
 			if tt.wantErr != nil {
 				assert.Equal(t, tt.wantErr, err)
 			} else {
@@ -115,7 +130,7 @@ func TestIncrementClicks(t *testing.T) {
 			name:     "successful increment",
 			shortURL: "abc123",
 			mockSetup: func() {
-				mock.ExpectExec("UPDATE urls SET clicks = clicks \\+ 1 WHERE shortUrl = \\?").
+				mock.ExpectExec("UPDATE urls SET clicks = clicks \\+ 1, lastClicked = NOW\\(\\) WHERE shortUrl = \\?").
 					WithArgs("abc123").
 					WillReturnResult(sqlmock.NewResult(0, 1)) // 0 = lastInsertId, 1 = rowsAffected
 			},
@@ -125,7 +140,7 @@ func TestIncrementClicks(t *testing.T) {
 			name:     "URL not found (no rows affected)",
 			shortURL: "notfound",
 			mockSetup: func() {
-				mock.ExpectExec("UPDATE urls SET clicks = clicks \\+ 1 WHERE shortUrl = \\?").
+				mock.ExpectExec("UPDATE urls SET clicks = clicks \\+ 1, lastClicked = NOW\\(\\) WHERE shortUrl = \\?").
 					WithArgs("notfound").
 					WillReturnResult(sqlmock.NewResult(0, 0)) // 0 rows affected
 			},
@@ -135,7 +150,7 @@ func TestIncrementClicks(t *testing.T) {
 			name:     "database error",
 			shortURL: "abc123",
 			mockSetup: func() {
-				mock.ExpectExec("UPDATE urls SET clicks = clicks \\+ 1 WHERE shortUrl = \\?").
+				mock.ExpectExec("UPDATE urls SET clicks = clicks \\+ 1, lastClicked = NOW\\(\\) WHERE shortUrl = \\?").
 					WithArgs("abc123").
 					WillReturnError(errors.New("database connection lost"))
 			},
@@ -145,7 +160,7 @@ func TestIncrementClicks(t *testing.T) {
 			name:     "URL not found (no rows affected)",
 			shortURL: "notfound",
 			mockSetup: func() {
-				mock.ExpectExec("UPDATE urls SET clicks = clicks \\+ 1 WHERE shortUrl = \\?").
+				mock.ExpectExec("UPDATE urls SET clicks = clicks \\+ 1, lastClicked = NOW\\(\\) WHERE shortUrl = \\?").
 					WithArgs("notfound").
 					WillReturnResult(sqlmock.NewResult(0, 0)) // 0 rows affected
 			},
@@ -194,9 +209,9 @@ func TestRepository_GetShortURLFromLong(t *testing.T) {
 			name:    "found URL",
 			longURL: "https://example.com",
 			mockSetup: func() {
-				rows := sqlmock.NewRows([]string{"id", "shortUrl", "longUrl"}).
-					AddRow(1, "abc123", "https://example.com")
-				mock.ExpectQuery("SELECT id, shortUrl, longUrl FROM urls WHERE longUrl").
+				rows := sqlmock.NewRows([]string{"id", "shortUrl", "longUrl", "expiresAt"}).
+					AddRow(1, "abc123", "https://example.com", nil)
+				mock.ExpectQuery("SELECT id, shortUrl, longUrl, expiresAt FROM urls WHERE longUrl .* ORDER BY expiresAt IS NULL DESC, expiresAt DESC LIMIT 1").
 					WithArgs("https://example.com").
 					WillReturnRows(rows)
 			},
@@ -211,7 +226,7 @@ func TestRepository_GetShortURLFromLong(t *testing.T) {
 			name:    "URL not found",
 			longURL: "https://notfound.com",
 			mockSetup: func() {
-				mock.ExpectQuery("SELECT id, shortUrl, longUrl FROM urls WHERE longUrl").
+				mock.ExpectQuery("SELECT id, shortUrl, longUrl, expiresAt FROM urls WHERE longUrl").
 					WithArgs("https://notfound.com").
 					WillReturnError(sql.ErrNoRows)
 			},
@@ -235,3 +250,316 @@ func TestRepository_GetShortURLFromLong(t *testing.T) {
 		})
 	}
 }
+
+func TestRepository_GetLongURLFromShort(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := &Repository{db: db}
+	ctx := context.Background()
+	expiresAt := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		shortURL  string
+		mockSetup func()
+		want      *URLs
+		wantErr   error
+	}{
+		{
+			name:     "found URL with expiry",
+			shortURL: "abc123",
+			mockSetup: func() {
+				rows := sqlmock.NewRows([]string{"id", "shortUrl", "longUrl", "expiresAt", "disabled"}).
+					AddRow(1, "abc123", "https://example.com", expiresAt, false)
+				mock.ExpectQuery("SELECT id, shortUrl, longUrl, expiresAt, disabled FROM urls WHERE shortUrl").
+					WithArgs("abc123").
+					WillReturnRows(rows)
+			},
+			want: &URLs{
+				ID:        1,
+				ShortURL:  "abc123",
+				LongURL:   "https://example.com",
+				ExpiresAt: &expiresAt,
+			},
+			wantErr: nil,
+		},
+		{
+			name:     "URL not found",
+			shortURL: "notfound",
+			mockSetup: func() {
+				mock.ExpectQuery("SELECT id, shortUrl, longUrl, expiresAt, disabled FROM urls WHERE shortUrl").
+					WithArgs("notfound").
+					WillReturnError(sql.ErrNoRows)
+			},
+			want:    nil,
+			wantErr: ErrURLNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockSetup()
+			got, err := repo.GetLongURLFromShort(ctx, tt.shortURL)
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.want, got)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestURLs_IsExpired(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Minute)
+	future := now.Add(time.Minute)
+
+	assert.False(t, (&URLs{}).IsExpired(now))
+	assert.True(t, (&URLs{ExpiresAt: &past}).IsExpired(now))
+	assert.False(t, (&URLs{ExpiresAt: &future}).IsExpired(now))
+}
+
+func TestRepository_GetStats(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := &Repository{db: db}
+	ctx := context.Background()
+	lastClicked := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		shortURL  string
+		mockSetup func()
+		want      *URLs
+		wantErr   error
+	}{
+		{
+			name:     "found stats",
+			shortURL: "abc123",
+			mockSetup: func() {
+				rows := sqlmock.NewRows([]string{"id", "shortUrl", "longUrl", "createdAt", "clicks", "lastClicked", "expiresAt", "disabled"}).
+					AddRow(1, "abc123", "https://example.com", "2025-01-01T00:00:00Z", 42, lastClicked, nil, false)
+				mock.ExpectQuery("SELECT id, shortUrl, longUrl, createdAt, clicks, lastClicked, expiresAt, disabled FROM urls WHERE shortUrl").
+					WithArgs("abc123").
+					WillReturnRows(rows)
+			},
+			want: &URLs{
+				ID:          1,
+				ShortURL:    "abc123",
+				LongURL:     "https://example.com",
+				CreatedAt:   "2025-01-01T00:00:00Z",
+				Clicks:      42,
+				LastClicked: &lastClicked,
+			},
+			wantErr: nil,
+		},
+		{
+			name:     "URL not found",
+			shortURL: "notfound",
+			mockSetup: func() {
+				mock.ExpectQuery("SELECT id, shortUrl, longUrl, createdAt, clicks, lastClicked, expiresAt, disabled FROM urls WHERE shortUrl").
+					WithArgs("notfound").
+					WillReturnError(sql.ErrNoRows)
+			},
+			want:    nil,
+			wantErr: ErrURLNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockSetup()
+			got, err := repo.GetStats(ctx, tt.shortURL)
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.want, got)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestRepository_GetTopURLs(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := &Repository{db: db}
+	ctx := context.Background()
+	expiresAt := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		mockSetup func()
+		want      []URLs
+		wantErr   bool
+	}{
+		{
+			name: "most clicked first",
+			mockSetup: func() {
+				rows := sqlmock.NewRows([]string{"id", "shortUrl", "longUrl", "expiresAt"}).
+					AddRow(2, "viral1", "https://example.com/viral", nil).
+					AddRow(1, "abc123", "https://example.com", expiresAt)
+				mock.ExpectQuery("SELECT id, shortUrl, longUrl, expiresAt FROM urls WHERE .+ ORDER BY clicks DESC, lastClicked DESC LIMIT").
+					WithArgs(2).
+					WillReturnRows(rows)
+			},
+			want: []URLs{
+				{ID: 2, ShortURL: "viral1", LongURL: "https://example.com/viral"},
+				{ID: 1, ShortURL: "abc123", LongURL: "https://example.com", ExpiresAt: &expiresAt},
+			},
+		},
+		{
+			name: "database error",
+			mockSetup: func() {
+				mock.ExpectQuery("SELECT id, shortUrl, longUrl, expiresAt FROM urls").
+					WithArgs(2).
+					WillReturnError(errors.New("connection refused"))
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockSetup()
+			got, err := repo.GetTopURLs(ctx, 2)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.want, got)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestRepository_LinkManagement(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := &Repository{db: db}
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		mockSetup func()
+		run       func() error
+		wantErr   error
+	}{
+		{
+			name: "update long URL",
+			mockSetup: func() {
+				mock.ExpectExec("UPDATE urls SET longUrl = \\? WHERE shortUrl = \\? AND deletedAt IS NULL").
+					WithArgs("https://example.org", "abc123").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			run:     func() error { return repo.UpdateLongURL(ctx, "abc123", "https://example.org") },
+			wantErr: nil,
+		},
+		{
+			name: "update long URL not found",
+			mockSetup: func() {
+				mock.ExpectExec("UPDATE urls SET longUrl").
+					WithArgs("https://example.org", "notfound").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			run:     func() error { return repo.UpdateLongURL(ctx, "notfound", "https://example.org") },
+			wantErr: ErrURLNotFound,
+		},
+		{
+			name: "disable",
+			mockSetup: func() {
+				mock.ExpectExec("UPDATE urls SET disabled = \\? WHERE shortUrl = \\? AND deletedAt IS NULL").
+					WithArgs(true, "abc123").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			run:     func() error { return repo.SetDisabled(ctx, "abc123", true) },
+			wantErr: nil,
+		},
+		{
+			name: "soft delete",
+			mockSetup: func() {
+				mock.ExpectExec("UPDATE urls SET deletedAt = NOW\\(\\) WHERE shortUrl = \\? AND deletedAt IS NULL").
+					WithArgs("abc123").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			run:     func() error { return repo.DeleteUrls(ctx, "abc123") },
+			wantErr: nil,
+		},
+		{
+			name: "delete already deleted",
+			mockSetup: func() {
+				mock.ExpectExec("UPDATE urls SET deletedAt").
+					WithArgs("abc123").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			run:     func() error { return repo.DeleteUrls(ctx, "abc123") },
+			wantErr: ErrURLNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockSetup()
+			err := tt.run()
+			assert.Equal(t, tt.wantErr, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestRepository_SaveUrlsBatch(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := &Repository{db: db}
+	ctx := context.Background()
+
+	urls := []URLs{
+		{ShortURL: "abc123", LongURL: "https://example.com"},
+		{ShortURL: "taken1", LongURL: "https://example.org"},
+	}
+
+	t.Run("commits batch with per-item duplicate", func(t *testing.T) {
+		mock.ExpectBegin()
+		prep := mock.ExpectPrepare("INSERT INTO urls")
+		prep.ExpectExec().
+			WithArgs("abc123", "https://example.com", nil).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		prep.ExpectExec().
+			WithArgs("taken1", "https://example.org", nil).
+			WillReturnError(&mysql.MySQLError{Number: 1062})
+		mock.ExpectCommit()
+
+		itemErrs, err := repo.SaveUrlsBatch(ctx, urls)
+		assert.NoError(t, err)
+		assert.Equal(t, []error{nil, ErrDuplicateShortCode}, itemErrs)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("rolls back on database error", func(t *testing.T) {
+		mock.ExpectBegin()
+		prep := mock.ExpectPrepare("INSERT INTO urls")
+		prep.ExpectExec().
+			WithArgs("abc123", "https://example.com", nil).
+			WillReturnError(errors.New("database connection lost"))
+		mock.ExpectRollback()
+
+		itemErrs, err := repo.SaveUrlsBatch(ctx, urls)
+		assert.Error(t, err)
+		assert.Nil(t, itemErrs)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
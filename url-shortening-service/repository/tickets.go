@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+)
+
+// ticketCounter names the tickets row short codes are numbered from
+const ticketCounter = "shortCode"
+
+// LeaseTickets reserves n sequential tickets and returns the first, satisfies idgenerator.TicketLeaser
+func (r *Repository) LeaseTickets(ctx context.Context, n int64) (int64, error) {
+	// a single atomic UPDATE, LAST_INSERT_ID(expr) hands the new counter value back through the result,
+	// so concurrent instances never get overlapping blocks and no transaction is needed
+	query := `UPDATE tickets SET nextId = LAST_INSERT_ID(nextId + ?) WHERE name = ?`
+
+	result, err := r.db.ExecContext(ctx, query, n, ticketCounter)
+	if err != nil {
+		return 0, fmt.Errorf("failed to lease tickets: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return 0, ErrTicketsNotSeeded
+	}
+
+	next, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get leased tickets: %w", err)
+	}
+
+	return next - n, nil
+}
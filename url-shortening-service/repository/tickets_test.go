@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepository_LeaseTickets(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := &Repository{db: db}
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		mockSetup func()
+		wantFirst int64
+		wantErr   error
+		errMsg    string
+	}{
+		{
+			name: "leases block",
+			mockSetup: func() {
+				mock.ExpectExec("UPDATE tickets SET nextId = LAST_INSERT_ID\\(nextId \\+ \\?\\) WHERE name = \\?").
+					WithArgs(int64(1000), "shortCode").
+					WillReturnResult(sqlmock.NewResult(2001, 1))
+			},
+			wantFirst: 1001,
+		},
+		{
+			name: "counter row missing",
+			mockSetup: func() {
+				mock.ExpectExec("UPDATE tickets").
+					WithArgs(int64(1000), "shortCode").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			wantErr: ErrTicketsNotSeeded,
+		},
+		{
+			name: "database error",
+			mockSetup: func() {
+				mock.ExpectExec("UPDATE tickets").
+					WithArgs(int64(1000), "shortCode").
+					WillReturnError(errors.New("database connection lost"))
+			},
+			errMsg: "failed to lease tickets",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockSetup()
+			first, err := repo.LeaseTickets(ctx, 1000)
+			switch {
+			case tt.errMsg != "":
+				assert.ErrorContains(t, err, tt.errMsg)
+			default:
+				assert.Equal(t, tt.wantErr, err)
+				assert.Equal(t, tt.wantFirst, first)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// worker_leases holds one row per snowflake machine ID, an instance owns a row until its expiresAt passes
+// these methods satisfy idgenerator.WorkerLeaser
+
+// AcquireWorkerID claims the lowest machine ID that is free or whose lease has expired
+func (r *Repository) AcquireWorkerID(ctx context.Context, owner string, ttl time.Duration) (int64, error) {
+	// a single UPDATE so two instances can't claim the same row,
+	// LAST_INSERT_ID(workerId) hands the claimed ID back through the result without a second query
+	query := `
+		UPDATE worker_leases
+		SET leaseOwner = ?, expiresAt = NOW(3) + INTERVAL ? MICROSECOND, workerId = LAST_INSERT_ID(workerId)
+		WHERE leaseOwner IS NULL OR expiresAt < NOW(3)
+		ORDER BY workerId
+		LIMIT 1
+	`
+
+	result, err := r.db.ExecContext(ctx, query, owner, ttl.Microseconds())
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire worker ID: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return 0, ErrNoFreeWorkerID
+	}
+
+	workerID, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get worker ID: %w", err)
+	}
+
+	return workerID, nil
+}
+
+// RenewWorkerID extends owner's lease on workerID, returning ErrWorkerLeaseLost if someone else has claimed it
+func (r *Repository) RenewWorkerID(ctx context.Context, workerID int64, owner string, ttl time.Duration) error {
+	query := `UPDATE worker_leases SET expiresAt = NOW(3) + INTERVAL ? MICROSECOND WHERE workerId = ? AND leaseOwner = ?`
+	err := r.execOnWorkerLease(ctx, query, ttl.Microseconds(), workerID, owner)
+	if err != nil && err != ErrWorkerLeaseLost {
+		return fmt.Errorf("failed to renew worker ID: %w", err)
+	}
+	return err
+}
+
+// ReleaseWorkerID frees workerID for other instances, returning ErrWorkerLeaseLost if owner no longer held it
+func (r *Repository) ReleaseWorkerID(ctx context.Context, workerID int64, owner string) error {
+	query := `UPDATE worker_leases SET leaseOwner = NULL, expiresAt = NULL WHERE workerId = ? AND leaseOwner = ?`
+	err := r.execOnWorkerLease(ctx, query, workerID, owner)
+	if err != nil && err != ErrWorkerLeaseLost {
+		return fmt.Errorf("failed to release worker ID: %w", err)
+	}
+	return err
+}
+
+// execOnWorkerLease runs a statement on a lease row expected to be held by the caller,
+// returning ErrWorkerLeaseLost when it isn't
+func (r *Repository) execOnWorkerLease(ctx context.Context, query string, args ...interface{}) error {
+	result, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrWorkerLeaseLost
+	}
+
+	return nil
+}
@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepository_AcquireWorkerID(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := &Repository{db: db}
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		mockSetup func()
+		wantID    int64
+		wantErr   error
+	}{
+		{
+			name: "claims worker ID",
+			mockSetup: func() {
+				mock.ExpectExec("UPDATE worker_leases SET leaseOwner = \\?, .*LAST_INSERT_ID\\(workerId\\)").
+					WithArgs("host-1", int64(30_000_000)).
+					WillReturnResult(sqlmock.NewResult(7, 1))
+			},
+			wantID: 7,
+		},
+		{
+			name: "claims worker ID zero",
+			mockSetup: func() {
+				mock.ExpectExec("UPDATE worker_leases").
+					WithArgs("host-1", int64(30_000_000)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			wantID: 0,
+		},
+		{
+			name: "all worker IDs leased",
+			mockSetup: func() {
+				mock.ExpectExec("UPDATE worker_leases").
+					WithArgs("host-1", int64(30_000_000)).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			wantErr: ErrNoFreeWorkerID,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockSetup()
+			id, err := repo.AcquireWorkerID(ctx, "host-1", 30*time.Second)
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.wantID, id)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+
+	t.Run("database error", func(t *testing.T) {
+		mock.ExpectExec("UPDATE worker_leases").
+			WillReturnError(errors.New("database connection lost"))
+
+		_, err := repo.AcquireWorkerID(ctx, "host-1", 30*time.Second)
+		assert.ErrorContains(t, err, "failed to acquire worker ID")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestRepository_RenewAndReleaseWorkerID(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := &Repository{db: db}
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		mockSetup func()
+		run       func() error
+		wantErr   error
+	}{
+		{
+			name: "renew",
+			mockSetup: func() {
+				mock.ExpectExec("UPDATE worker_leases SET expiresAt = NOW\\(3\\) \\+ INTERVAL \\? MICROSECOND WHERE workerId = \\? AND leaseOwner = \\?").
+					WithArgs(int64(30_000_000), int64(7), "host-1").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			run:     func() error { return repo.RenewWorkerID(ctx, 7, "host-1", 30*time.Second) },
+			wantErr: nil,
+		},
+		{
+			name: "renew after another instance claimed it",
+			mockSetup: func() {
+				mock.ExpectExec("UPDATE worker_leases SET expiresAt").
+					WithArgs(int64(30_000_000), int64(7), "host-1").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			run:     func() error { return repo.RenewWorkerID(ctx, 7, "host-1", 30*time.Second) },
+			wantErr: ErrWorkerLeaseLost,
+		},
+		{
+			name: "release",
+			mockSetup: func() {
+				mock.ExpectExec("UPDATE worker_leases SET leaseOwner = NULL, expiresAt = NULL WHERE workerId = \\? AND leaseOwner = \\?").
+					WithArgs(int64(7), "host-1").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			run:     func() error { return repo.ReleaseWorkerID(ctx, 7, "host-1") },
+			wantErr: nil,
+		},
+		{
+			name: "release after another instance claimed it",
+			mockSetup: func() {
+				mock.ExpectExec("UPDATE worker_leases SET leaseOwner = NULL").
+					WithArgs(int64(7), "host-1").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			run:     func() error { return repo.ReleaseWorkerID(ctx, 7, "host-1") },
+			wantErr: ErrWorkerLeaseLost,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockSetup()
+			err := tt.run()
+			assert.Equal(t, tt.wantErr, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
@@ -1,10 +1,17 @@
 package server
 
 import (
-	"flag"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/oyinetare/url-shortener/api"
@@ -33,37 +40,414 @@ func (s *Server) Start() error {
 	// add logging middleware
 	s.router.Use(loggingMiddleware)
 
-	var shortCodeLength int
-	flag.IntVar(&shortCodeLength, "shortCode", s.config.ShortCodeLength, "Length of the short code")
-	flag.Parse()
-
 	// idGenerator := idgenerator.NewMD5Generator(s.config.ShortCodeLength)
-	idGenerator := idgenerator.NewSnowflakeGenerator()
-	cache := cache.NewInMemoryCache(s.config.CacheTTL)
+	idGenerator, releaseWorkerID, err := s.newIDGenerator()
+	if err != nil {
+		return err
+	}
+	// released last on the way out, once nothing can generate another ID
+	defer releaseWorkerID()
+
+	cache, err := s.newCache()
+	if err != nil {
+		return err
+	}
+	s.loadSnapshot(cache)
+
+	reverseCache, err := s.newReverseCache()
+	if err != nil {
+		return err
+	}
 
 	// initialise API handler and register routes
-	shortenerAPI := api.NewUrlShortenerAPI(s.repo, s.config.BaseURL, idGenerator, cache)
+	shortenerAPI := api.NewUrlShortenerAPI(s.repo, s.config.BaseURL, idGenerator, cache,
+		api.WithAliasLength(s.config.AliasMinLength, s.config.AliasMaxLength),
+		api.WithDefaultTTL(s.config.DefaultLinkTTL),
+		api.WithNegativeCacheTTL(s.config.NegativeTTL),
+		api.WithReverseCache(reverseCache),
+		api.WithMaxBatchSize(s.config.BatchMaxSize),
+		api.WithAdminToken(s.config.AdminToken),
+	)
 
-	s.router.HandleFunc("/shorten", shortenerAPI.ShortenHandler).Methods("POST")
-	s.router.HandleFunc("/{shortCode}", shortenerAPI.RedirectHandler).Methods("GET")
+	s.registerRoutes(shortenerAPI)
+
+	// preload the most clicked links before accepting traffic, so a deploy doesn't send every first request to MySQL
+	s.warmCache(shortenerAPI)
 
 	fmt.Printf("\n🚀 URL Shortener started on port %d\n", s.config.Port)
 	fmt.Printf("📍 Base URL: %s\n", s.config.BaseURL)
-	fmt.Printf("🔤 Short code length: %d\n", shortCodeLength)
-	fmt.Printf("💾 Cache TTL: %v\n\n", s.config.CacheTTL)
+	fmt.Printf("🔤 Short code length: %d\n", s.config.ShortCodeLength)
+	fmt.Printf("🆔 ID generator: %s\n", s.config.IDGenerator)
+	fmt.Printf("💾 Cache: %s, TTL %v\n", s.config.CacheBackend, s.config.CacheTTL)
+	fmt.Printf("⏳ Default link TTL: %v\n\n", s.config.DefaultLinkTTL)
 
 	fmt.Println("API Endpoints:")
-	fmt.Println("POST /shorten      - Shorten a URL")
-	fmt.Println("GET  /{shortCode}  - Redirect to long URL")
+	fmt.Println("POST   /api/v1/shorten                  - Shorten a URL")
+	fmt.Println("POST   /api/v1/shorten/batch            - Shorten an array of URLs")
+	fmt.Println("GET    /{shortCode}                     - Redirect to long URL")
+	fmt.Println("GET    /{shortCode}+                    - Preview the destination of a short URL")
+	fmt.Println("PATCH  /api/v1/links/{shortCode}        - Update destination or disable a short URL (admin)")
+	fmt.Println("DELETE /api/v1/links/{shortCode}        - Delete a short URL (admin)")
+	fmt.Println("GET    /api/v1/links/{shortCode}/stats  - Click statistics for a short URL")
+	fmt.Println("GET    /api/v1/links/{shortCode}/qr     - QR code for a short URL")
+	fmt.Println("GET    /api/v1/openapi.json             - OpenAPI specification")
+	fmt.Println("GET    /api/v1/admin/cache              - Cache statistics (admin)")
+	fmt.Println("GET    /api/v1/admin/cache/{shortCode}  - Inspect a cached entry (admin)")
+	fmt.Println("DELETE /api/v1/admin/cache              - Flush the cache (admin)")
+	fmt.Println("GET    /api/v1/admin/metrics            - Process metrics (admin)")
+	fmt.Println("POST   /shorten                         - Deprecated alias of /api/v1/shorten")
 	fmt.Println("\nExample curl command:")
-	fmt.Printf("curl -X POST %s/shorten \\\n", s.config.BaseURL)
+	fmt.Printf("curl -X POST %s/api/v1/shorten \\\n", s.config.BaseURL)
 	fmt.Println(`  -H "Content-Type: application/json" \`)
 	fmt.Println(`  -d '{"longUrl":"https://www.example.com"}'`)
 
 	addr := fmt.Sprintf(":%d", s.config.Port)
 	log.Printf("Server starting on %s", addr)
 
-	return http.ListenAndServe(addr, s.router)
+	httpServer := &http.Server{Addr: addr, Handler: s.router}
+
+	// shut down gracefully on SIGINT/SIGTERM so in-flight requests finish and the cache snapshot gets written
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- httpServer.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("Shutting down...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Error shutting down: %v", err)
+	}
+	s.saveSnapshot(cache)
+
+	return nil
+}
+
+// loadSnapshot warms the cache from the snapshot written at the last shutdown, if snapshots are enabled
+// a corrupt snapshot only loses the entries from the damaged record on
+func (s *Server) loadSnapshot(c cache.CacheInterface) {
+	snapshotter, ok := c.(cache.Snapshotter)
+	if s.config.SnapshotPath == "" || !ok {
+		return
+	}
+
+	n, err := snapshotter.LoadSnapshot(s.config.SnapshotPath)
+	if err != nil {
+		log.Printf("Cache snapshot %s partly loaded: %v", s.config.SnapshotPath, err)
+	}
+	log.Printf("Loaded %d cache entries from %s", n, s.config.SnapshotPath)
+}
+
+// saveSnapshot writes the cache to the snapshot file, if snapshots are enabled
+func (s *Server) saveSnapshot(c cache.CacheInterface) {
+	snapshotter, ok := c.(cache.Snapshotter)
+	if s.config.SnapshotPath == "" {
+		return
+	}
+	if !ok {
+		log.Printf("Cache backend %q doesn't support snapshots", s.config.CacheBackend)
+		return
+	}
+
+	if err := snapshotter.SaveSnapshot(s.config.SnapshotPath); err != nil {
+		log.Printf("Failed to save cache snapshot: %v", err)
+		return
+	}
+	log.Printf("Saved cache snapshot to %s", s.config.SnapshotPath)
+}
+
+// warmCache preloads the cache within the configured timeout, a failed or partial warm-up only costs cache misses
+func (s *Server) warmCache(shortenerAPI *api.UrlShortenerAPI) {
+	if s.config.CacheWarmup.Count <= 0 {
+		return
+	}
+
+	// bounded so a slow warmup delays startup by at most the configured timeout
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.CacheWarmup.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	n, err := shortenerAPI.WarmCache(ctx, s.config.CacheWarmup.Count)
+	if err != nil {
+		log.Printf("Cache warm-up stopped after %d links: %v", n, err)
+		return
+	}
+	log.Printf("Cache warmed with %d links in %v", n, time.Since(start))
+}
+
+// maxShortCodeLength is the width of the urls.shortUrl column
+const maxShortCodeLength = 20
+
+// newIDGenerator builds the generator selected by ID_GENERATOR, obfuscated when CODE_OBFUSCATION_KEY is set,
+// the returned func releases anything it holds
+func (s *Server) newIDGenerator() (idgenerator.IDGeneratorInterface, func(), error) {
+	// longer codes would pass here and then fail every insert
+	if s.config.ShortCodeLength > maxShortCodeLength {
+		return nil, nil, fmt.Errorf("SHORT_CODE_LENGTH must be at most %d, the width of urls.shortUrl: %w",
+			maxShortCodeLength, idgenerator.ErrShortCodeLength)
+	}
+
+	var generator idgenerator.NumericIDGenerator
+	release := func() {}
+
+	switch s.config.IDGenerator {
+	case "", "snowflake":
+		snowflake, releaseSnowflake, err := s.newSnowflakeGenerator()
+		if err != nil {
+			return nil, nil, err
+		}
+		generator, release = snowflake, releaseSnowflake
+	case "ticket":
+		tickets, err := s.newTicketGenerator()
+		if err != nil {
+			return nil, nil, err
+		}
+		generator = tickets
+	default:
+		return nil, nil, fmt.Errorf("unknown ID generator %q", s.config.IDGenerator)
+	}
+
+	if s.config.ObfuscationKey == "" {
+		return generator, release, nil
+	}
+
+	obfuscated, err := idgenerator.NewObfuscatedGenerator(generator, []byte(s.config.ObfuscationKey))
+	if err != nil {
+		release()
+		return nil, nil, fmt.Errorf("invalid CODE_OBFUSCATION_KEY: %w", err)
+	}
+	return obfuscated, release, nil
+}
+
+// newTicketGenerator builds a generator numbering short codes from the tickets table, TICKET_BLOCK_SIZE at a time
+func (s *Server) newTicketGenerator() (*idgenerator.TicketGenerator, error) {
+	leaser, ok := s.repo.(idgenerator.TicketLeaser)
+	if !ok {
+		return nil, fmt.Errorf("repository doesn't support leasing tickets")
+	}
+
+	// bounded so an unreachable database fails startup instead of hanging it
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	generator, err := idgenerator.NewTicketGenerator(ctx, leaser, s.config.ShortCodeLength,
+		idgenerator.WithBlockSize(int64(s.config.TicketBlock)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ticket ID generator: %w", err)
+	}
+	return generator, nil
+}
+
+// newSnowflakeGenerator builds the snowflake generator for WORKER_ID, or for a machine ID leased from the database
+// when WORKER_LEASE_SECONDS is set, the returned func releases the lease
+func (s *Server) newSnowflakeGenerator() (*idgenerator.SnowflakeGenerator, func(), error) {
+	opts := []idgenerator.SnowflakeOption{
+		idgenerator.WithShortCodeLength(s.config.ShortCodeLength),
+		idgenerator.WithMaxClockRollback(s.config.Worker.MaxRollback),
+	}
+	if !s.config.Worker.Epoch.IsZero() {
+		opts = append(opts, idgenerator.WithEpoch(s.config.Worker.Epoch))
+	}
+
+	if s.config.Worker.LeaseTTL <= 0 {
+		generator, err := idgenerator.NewSnowflakeGenerator(s.config.Worker.ID, opts...)
+		if err != nil {
+			return nil, nil, idGeneratorError(err)
+		}
+		return generator, func() {}, nil
+	}
+
+	leaser, ok := s.repo.(idgenerator.WorkerLeaser)
+	if !ok {
+		return nil, nil, fmt.Errorf("repository doesn't support leasing worker IDs")
+	}
+
+	// bounded so an unreachable database fails startup instead of hanging it
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	generator, lease, err := idgenerator.LeaseSnowflakeGenerator(ctx, leaser, leaseOwner(), s.config.Worker.LeaseTTL, opts...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to lease worker ID: %w", idGeneratorError(err))
+	}
+	log.Printf("Leased worker ID %d", generator.MachineID())
+
+	release := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := lease.Close(ctx); err != nil {
+			log.Printf("Failed to release worker ID %d: %v", generator.MachineID(), err)
+			return
+		}
+		log.Printf("Released worker ID %d", generator.MachineID())
+	}
+	return generator, release, nil
+}
+
+// idGeneratorError explains a generator that can't be built with the configured short code length
+func idGeneratorError(err error) error {
+	if err == idgenerator.ErrShortCodeLength {
+		return fmt.Errorf("SHORT_CODE_LENGTH must be at least %d for snowflake IDs: %w", idgenerator.SnowflakeCodeLength, err)
+	}
+	return fmt.Errorf("failed to create ID generator: %w", err)
+}
+
+// leaseOwner identifies this process in the lease table, random so a restarted process never mistakes an old lease for its own
+func leaseOwner() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(suffix))
+}
+
+// newCache builds the cache backend selected by CACHE_BACKEND
+func (s *Server) newCache() (cache.CacheInterface, error) {
+	switch s.config.CacheBackend {
+	case "", "memory":
+		return s.newLocalCache(s.config.CacheTTL, cache.WithStaleWhileRevalidate(s.config.StaleWindow, s.reloadURL)), nil
+	case "redis":
+		return s.newRedisCache(s.config.CacheTTL, s.config.Redis.DB)
+	case "tiered":
+		redisCache, err := s.newRedisCache(s.config.CacheTTL, s.config.Redis.DB)
+		if err != nil {
+			return nil, err
+		}
+		l1 := s.newLocalCache(s.config.CacheL1TTL,
+			cache.WithStaleWhileRevalidate(s.config.StaleWindow, cache.WriteThrough(redisCache, s.reloadURL)))
+		return cache.NewTieredCache(l1, redisCache), nil
+	default:
+		return nil, fmt.Errorf("unknown cache backend %q", s.config.CacheBackend)
+	}
+}
+
+// newReverseCache builds the long URL to short code cache, nil when disabled
+// shared through Redis with a Redis backend, so a link disabled on one replica stops deduping on all of them
+func (s *Server) newReverseCache() (cache.CacheInterface, error) {
+	if s.config.ReverseCacheTTL <= 0 {
+		return nil, nil
+	}
+
+	switch s.config.CacheBackend {
+	case "redis", "tiered":
+		// in its own db, the admin API's size and flush act on the whole db
+		if s.config.Redis.ReverseDB == s.config.Redis.DB {
+			return nil, fmt.Errorf("REDIS_REVERSE_DB must differ from REDIS_DB %d", s.config.Redis.DB)
+		}
+		return s.newRedisCache(s.config.ReverseCacheTTL, s.config.Redis.ReverseDB, cache.WithRedisKeyPrefix("rev:"))
+	default:
+		return s.newLocalCache(s.config.ReverseCacheTTL), nil
+	}
+}
+
+// newLocalCache builds a process-local cache, sharded unless CACHE_SHARDS is 1
+func (s *Server) newLocalCache(ttl time.Duration, extra ...cache.Option) cache.CacheInterface {
+	opts := append([]cache.Option{
+		cache.WithMaxEntries(s.config.CacheMaxEntries),
+		cache.WithMaxBytes(s.config.CacheMaxBytes),
+	}, extra...)
+
+	if s.config.CacheShards > 1 {
+		return cache.NewShardedCache(ttl, s.config.CacheShards, opts...)
+	}
+	return cache.NewInMemoryCache(ttl, opts...)
+}
+
+// reloadURL refreshes a stale cache entry, links that no longer resolve are reported as cache.ErrNoLongerValid
+func (s *Server) reloadURL(ctx context.Context, shortCode string) (string, *time.Time, error) {
+	urlData, err := s.repo.GetLongURLFromShort(ctx, shortCode)
+	if err == repository.ErrURLNotFound {
+		return "", nil, cache.ErrNoLongerValid
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	if urlData.Disabled || urlData.IsExpired(time.Now()) {
+		return "", nil, cache.ErrNoLongerValid
+	}
+
+	return urlData.LongURL, urlData.ExpiresAt, nil
+}
+
+// newRedisCache connects to Redis, failing startup rather than running with every lookup a cache miss
+func (s *Server) newRedisCache(ttl time.Duration, db int, opts ...cache.RedisOption) (*cache.RedisCache, error) {
+	redisCache := cache.NewRedisCache(s.config.Redis.Addr, s.config.Redis.Password, db, ttl, opts...)
+	if err := redisCache.Ping(); err != nil {
+		return nil, err
+	}
+	return redisCache, nil
+}
+
+// registerRoutes wires the API handlers into the router
+// Management endpoints live under /api/v1, short codes are served from the root
+func (s *Server) registerRoutes(shortenerAPI *api.UrlShortenerAPI) {
+	v1 := s.router.PathPrefix("/api/v1").Subrouter()
+	v1.HandleFunc("/shorten", shortenerAPI.ShortenHandler).Methods("POST")
+	v1.HandleFunc("/shorten/batch", shortenerAPI.BatchShortenHandler).Methods("POST")
+	v1.HandleFunc("/links/{shortCode}", shortenerAPI.UpdateLinkHandler).Methods("PATCH")
+	v1.HandleFunc("/links/{shortCode}", shortenerAPI.DeleteLinkHandler).Methods("DELETE")
+	v1.HandleFunc("/links/{shortCode}/stats", shortenerAPI.StatsHandler).Methods("GET")
+	v1.HandleFunc("/links/{shortCode}/qr", shortenerAPI.QRCodeHandler).Methods("GET")
+	v1.HandleFunc("/admin/cache", shortenerAPI.CacheStatsHandler).Methods("GET")
+	v1.HandleFunc("/admin/cache", shortenerAPI.FlushCacheHandler).Methods("DELETE")
+	v1.HandleFunc("/admin/cache/{shortCode}", shortenerAPI.CacheEntryHandler).Methods("GET")
+	v1.HandleFunc("/admin/metrics", shortenerAPI.MetricsHandler).Methods("GET")
+	// keep api/openapi.json in step with these routes, TestOpenAPISpecCoversRoutes checks it
+	v1.HandleFunc("/openapi.json", shortenerAPI.OpenAPIHandler).Methods("GET")
+
+	// pre-versioning clients still post to /shorten
+	s.router.Handle("/shorten", deprecated("/api/v1/shorten", http.HandlerFunc(shortenerAPI.ShortenHandler))).Methods("POST")
+
+	// registered before the redirect so "/{shortCode}+" isn't read as a short code ending in "+"
+	s.router.HandleFunc("/{shortCode}+", shortenerAPI.PreviewHandler).Methods("GET")
+	s.router.HandleFunc("/{shortCode}", shortenerAPI.RedirectHandler).Methods("GET")
+
+	// no short code may shadow a path the router serves itself
+	shortenerAPI.ReserveShortCodes(reservedShortCodes(s.router)...)
+}
+
+// reservedShortCodes returns the distinct first path segments of every route that starts with a literal
+func reservedShortCodes(router *mux.Router) []string {
+	var codes []string
+	seen := make(map[string]bool)
+	router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		tmpl, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+
+		segment := strings.SplitN(strings.TrimPrefix(tmpl, "/"), "/", 2)[0]
+		if segment != "" && !strings.HasPrefix(segment, "{") && !seen[segment] {
+			seen[segment] = true
+			codes = append(codes, segment)
+		}
+		return nil
+	})
+	return codes
+}
+
+// deprecated marks responses from a legacy route with a Deprecation header pointing at its successor
+func deprecated(successor string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", successor))
+		next.ServeHTTP(w, r)
+	})
 }
 
 func loggingMiddleware(next http.Handler) http.Handler {
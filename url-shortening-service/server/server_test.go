@@ -2,24 +2,32 @@ package server
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/gorilla/mux"
+	"github.com/oyinetare/url-shortener/api"
+	"github.com/oyinetare/url-shortener/cache"
 	"github.com/oyinetare/url-shortener/config"
+	"github.com/oyinetare/url-shortener/idgenerator"
 	"github.com/oyinetare/url-shortener/repository"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 type MockRepository struct {
 	mock.Mock
 }
 
-func (m *MockRepository) SaveUrls(ctx context.Context, shortUrl, longUrl string) error {
+func (m *MockRepository) SaveUrls(ctx context.Context, shortUrl, longUrl string, expiresAt *time.Time) error {
 	args := m.Called()
 	if args.Get(0) == nil {
 		return args.Error(1)
@@ -27,6 +35,14 @@ func (m *MockRepository) SaveUrls(ctx context.Context, shortUrl, longUrl string)
 
 	return args.Error(1)
 }
+func (m *MockRepository) SaveUrlsBatch(ctx context.Context, urls []repository.URLs) ([]error, error) {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]error), args.Error(1)
+}
 func (m *MockRepository) GetShortURLFromLong(ctx context.Context, longUrl string) (*repository.URLs, error) {
 	args := m.Called()
 	if args.Get(0) == nil {
@@ -52,6 +68,39 @@ func (m *MockRepository) IncrementClicks(ctx context.Context, shortUrl string) e
 	return args.Error(1)
 }
 
+func (m *MockRepository) GetStats(ctx context.Context, shortUrl string) (*repository.URLs, error) {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).(*repository.URLs), args.Error(1)
+}
+
+func (m *MockRepository) GetTopURLs(ctx context.Context, limit int) ([]repository.URLs, error) {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]repository.URLs), args.Error(1)
+}
+
+func (m *MockRepository) UpdateLongURL(ctx context.Context, shortUrl, longUrl string) error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+func (m *MockRepository) SetDisabled(ctx context.Context, shortUrl string, disabled bool) error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+func (m *MockRepository) DeleteUrls(ctx context.Context, shortUrl string) error {
+	args := m.Called()
+	return args.Error(0)
+}
+
 func (m *MockRepository) Disconnect() error {
 	args := m.Called()
 	return args.Error(0)
@@ -88,24 +137,404 @@ func TestRoutes(t *testing.T) {
 	baseUrl := os.Getenv("BASE_URL")
 
 	cfg := &config.Config{
-		Port:    port,
-		BaseURL: baseUrl,
+		Port:            port,
+		BaseURL:         baseUrl,
+		ShortCodeLength: idgenerator.SnowflakeCodeLength,
 	}
 
 	srv := New(mockRepo, cfg)
 
 	// start server in goroutine
+	startErr := make(chan error, 1)
 	go func() {
-		srv.Start()
+		startErr <- srv.Start()
 	}()
 
 	// give server time to sleep
 	time.Sleep(100 * time.Millisecond)
 
+	// still serving, Start only returns early on a setup or listen error
+	select {
+	case err := <-startErr:
+		t.Fatalf("Start failed: %v", err)
+	default:
+	}
+
 	// test registered routes
 	assert.NotNil(t, srv.router)
 }
 
+func TestRegisterRoutes(t *testing.T) {
+	mockRepo := new(MockRepository)
+	srv := New(mockRepo, &config.Config{BaseURL: "http://localhost:8080"})
+	srv.router = mux.NewRouter()
+
+	generator, err := idgenerator.NewSnowflakeGenerator(0)
+	require.NoError(t, err)
+	shortenerAPI := api.NewUrlShortenerAPI(mockRepo, srv.config.BaseURL, generator, cache.NewInMemoryCache(time.Hour))
+	srv.registerRoutes(shortenerAPI)
+
+	tests := []struct {
+		name               string
+		path               string
+		expectDeprecation  bool
+		expectedStatusCode int
+	}{
+		{
+			name:               "versioned shorten route",
+			path:               "/api/v1/shorten",
+			expectDeprecation:  false,
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:               "deprecated shorten alias",
+			path:               "/shorten",
+			expectDeprecation:  true,
+			expectedStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// invalid body so the handler answers without touching the repository
+			req := httptest.NewRequest("POST", tt.path, strings.NewReader(`{invalid json}`))
+			w := httptest.NewRecorder()
+			srv.router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatusCode, w.Code)
+			if tt.expectDeprecation {
+				assert.Equal(t, "true", w.Header().Get("Deprecation"))
+				assert.Contains(t, w.Header().Get("Link"), "</api/v1/shorten>")
+			} else {
+				assert.Empty(t, w.Header().Get("Deprecation"))
+			}
+		})
+	}
+
+	assert.ElementsMatch(t, []string{"api", "shorten"}, reservedShortCodes(srv.router))
+}
+
+func TestOpenAPISpecCoversRoutes(t *testing.T) {
+	mockRepo := new(MockRepository)
+	srv := New(mockRepo, &config.Config{BaseURL: "http://localhost:8080"})
+	srv.router = mux.NewRouter()
+
+	generator, err := idgenerator.NewSnowflakeGenerator(0)
+	require.NoError(t, err)
+	shortenerAPI := api.NewUrlShortenerAPI(mockRepo, srv.config.BaseURL, generator, cache.NewInMemoryCache(time.Hour))
+	srv.registerRoutes(shortenerAPI)
+
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	require.NoError(t, json.Unmarshal(api.OpenAPISpec, &spec))
+
+	// every registered route and method needs a spec entry
+	registered := make(map[string]bool)
+	err = srv.router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		tmpl, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			// subrouter prefixes have no methods of their own
+			return nil
+		}
+
+		for _, method := range methods {
+			operation := strings.ToLower(method)
+			registered[tmpl+" "+operation] = true
+			_, ok := spec.Paths[tmpl][operation]
+			assert.True(t, ok, "route %s %s is missing from api/openapi.json", method, tmpl)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	// and the spec shouldn't document routes that don't exist
+	for path, operations := range spec.Paths {
+		for operation := range operations {
+			if operation == "parameters" {
+				continue
+			}
+			assert.True(t, registered[path+" "+operation], "api/openapi.json documents %s %s which is not registered", operation, path)
+		}
+	}
+}
+
+func TestWarmCache(t *testing.T) {
+	tests := []struct {
+		name         string
+		warmup       config.CacheWarmupConfig
+		mockSetup    func(*MockRepository)
+		expectedSize int
+	}{
+		{
+			name:   "preloads top links",
+			warmup: config.CacheWarmupConfig{Count: 2, Timeout: time.Second},
+			mockSetup: func(m *MockRepository) {
+				m.On("GetTopURLs").Return([]repository.URLs{
+					{ShortURL: "viral1", LongURL: "https://example.com/viral"},
+					{ShortURL: "abc123", LongURL: "https://example.com"},
+				}, nil)
+			},
+			expectedSize: 2,
+		},
+		{
+			name:         "disabled",
+			warmup:       config.CacheWarmupConfig{Count: 0},
+			mockSetup:    func(m *MockRepository) {},
+			expectedSize: 0,
+		},
+		{
+			name:   "failure is not fatal",
+			warmup: config.CacheWarmupConfig{Count: 2, Timeout: time.Second},
+			mockSetup: func(m *MockRepository) {
+				m.On("GetTopURLs").Return(nil, assert.AnError)
+			},
+			expectedSize: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockRepository)
+			tt.mockSetup(mockRepo)
+
+			srv := New(mockRepo, &config.Config{BaseURL: "http://localhost:8080", CacheWarmup: tt.warmup})
+			generator, err := idgenerator.NewSnowflakeGenerator(0)
+			require.NoError(t, err)
+			cache := cache.NewInMemoryCache(time.Hour)
+			shortenerAPI := api.NewUrlShortenerAPI(mockRepo, srv.config.BaseURL, generator, cache)
+
+			srv.warmCache(shortenerAPI)
+
+			assert.Equal(t, tt.expectedSize, cache.Size())
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestNewSnowflakeGenerator(t *testing.T) {
+	tests := []struct {
+		name          string
+		worker        config.WorkerConfig
+		codeLength    int
+		wantMachineID int64
+		wantErr       string
+	}{
+		{name: "configured worker ID", worker: config.WorkerConfig{ID: 42}, wantMachineID: 42},
+		{name: "padded to a longer code", worker: config.WorkerConfig{ID: 42}, codeLength: 16, wantMachineID: 42},
+		{name: "code too short for snowflake IDs", codeLength: 8, wantErr: "SHORT_CODE_LENGTH must be at least 11"},
+		{name: "worker ID out of range", worker: config.WorkerConfig{ID: 1024}, wantErr: "machine ID must be between 0 and 1023"},
+		{name: "epoch in the future", worker: config.WorkerConfig{Epoch: time.Now().Add(time.Hour)}, wantErr: "snowflake epoch"},
+		// the mock repository has no lease table
+		{name: "lease unsupported", worker: config.WorkerConfig{LeaseTTL: time.Minute}, wantErr: "doesn't support leasing"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			codeLength := tt.codeLength
+			if codeLength == 0 {
+				codeLength = idgenerator.SnowflakeCodeLength
+			}
+			srv := New(new(MockRepository), &config.Config{ShortCodeLength: codeLength, Worker: tt.worker})
+
+			generator, release, err := srv.newSnowflakeGenerator()
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			defer release()
+			assert.Equal(t, tt.wantMachineID, generator.MachineID())
+
+			code, err := generator.GenerateShortCode()
+			require.NoError(t, err)
+			assert.Len(t, code, codeLength)
+		})
+	}
+}
+
+// ticketRepository adds ticket leasing to the mock repository
+type ticketRepository struct {
+	*MockRepository
+	next int64
+}
+
+func (r *ticketRepository) LeaseTickets(ctx context.Context, n int64) (int64, error) {
+	first := r.next
+	r.next += n
+	return first, nil
+}
+
+func TestNewIDGenerator(t *testing.T) {
+	tests := []struct {
+		name       string
+		repo       repository.RepositoryInterface
+		kind       string
+		key        string
+		codeLength int
+		wantCode   string
+		wantErr    string
+	}{
+		{name: "snowflake by default", repo: new(MockRepository)},
+		{name: "obfuscated snowflake", repo: new(MockRepository), key: "0123456789abcdef"},
+		{name: "ticket", repo: &ticketRepository{MockRepository: new(MockRepository), next: 62}, kind: "ticket", wantCode: "00000000010"},
+		{name: "obfuscated ticket", repo: &ticketRepository{MockRepository: new(MockRepository), next: 62}, kind: "ticket", key: "0123456789abcdef"},
+		{name: "obfuscation key too short", repo: new(MockRepository), key: "secret", wantErr: "invalid CODE_OBFUSCATION_KEY"},
+		{name: "ticket without a tickets table", repo: new(MockRepository), kind: "ticket", wantErr: "doesn't support leasing tickets"},
+		{name: "unknown generator", repo: new(MockRepository), kind: "uuid", wantErr: `unknown ID generator "uuid"`},
+		{name: "code longer than urls.shortUrl", repo: new(MockRepository), codeLength: 21, wantErr: "SHORT_CODE_LENGTH must be at most 20"},
+		{name: "ticket code longer than urls.shortUrl", repo: &ticketRepository{MockRepository: new(MockRepository)}, kind: "ticket", codeLength: 21, wantErr: "SHORT_CODE_LENGTH must be at most 20"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			codeLength := tt.codeLength
+			if codeLength == 0 {
+				codeLength = idgenerator.SnowflakeCodeLength
+			}
+			srv := New(tt.repo, &config.Config{
+				ShortCodeLength: codeLength,
+				IDGenerator:     tt.kind,
+				TicketBlock:     100,
+				ObfuscationKey:  tt.key,
+			})
+
+			generator, release, err := srv.newIDGenerator()
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				assert.Nil(t, generator)
+				return
+			}
+			require.NoError(t, err)
+			defer release()
+
+			code, err := generator.GenerateShortCode()
+			require.NoError(t, err)
+			assert.Len(t, code, idgenerator.SnowflakeCodeLength)
+			if tt.wantCode != "" {
+				assert.Equal(t, tt.wantCode, code)
+			}
+			if tt.key != "" {
+				assert.NotEqual(t, "00000000010", code)
+			}
+		})
+	}
+}
+
+func TestNewReverseCache(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       config.Config
+		wantCache bool
+		wantErr   string
+	}{
+		{name: "disabled", cfg: config.Config{CacheBackend: "memory"}},
+		{name: "in memory", cfg: config.Config{CacheBackend: "memory", ReverseCacheTTL: time.Hour}, wantCache: true},
+		// sharing the db would let the admin API count and flush both caches together
+		{
+			name:    "redis db shared with the cache",
+			cfg:     config.Config{CacheBackend: "redis", ReverseCacheTTL: time.Hour, Redis: config.RedisConfig{DB: 2, ReverseDB: 2}},
+			wantErr: "REDIS_REVERSE_DB must differ from REDIS_DB 2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := New(new(MockRepository), &tt.cfg)
+
+			reverseCache, err := srv.newReverseCache()
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantCache, reverseCache != nil)
+		})
+	}
+}
+
+func TestReloadURL(t *testing.T) {
+	expired := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name        string
+		urlData     *repository.URLs
+		err         error
+		expectedURL string
+		expectedErr error
+	}{
+		{
+			name:        "live link",
+			urlData:     &repository.URLs{ShortURL: "abc123", LongURL: "https://example.com"},
+			expectedURL: "https://example.com",
+		},
+		{
+			name:        "deleted link",
+			err:         repository.ErrURLNotFound,
+			expectedErr: cache.ErrNoLongerValid,
+		},
+		{
+			name:        "disabled link",
+			urlData:     &repository.URLs{ShortURL: "abc123", LongURL: "https://example.com", Disabled: true},
+			expectedErr: cache.ErrNoLongerValid,
+		},
+		{
+			name:        "expired link",
+			urlData:     &repository.URLs{ShortURL: "abc123", LongURL: "https://example.com", ExpiresAt: &expired},
+			expectedErr: cache.ErrNoLongerValid,
+		},
+		{
+			name:        "database down",
+			err:         assert.AnError,
+			expectedErr: assert.AnError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockRepository)
+			if tt.urlData != nil {
+				mockRepo.On("GetLongURLFromShort").Return(tt.urlData, nil)
+			} else {
+				mockRepo.On("GetLongURLFromShort").Return(nil, tt.err)
+			}
+
+			srv := New(mockRepo, &config.Config{})
+			longURL, _, err := srv.reloadURL(context.Background(), "abc123")
+
+			assert.Equal(t, tt.expectedErr, err)
+			assert.Equal(t, tt.expectedURL, longURL)
+		})
+	}
+}
+
+func TestCacheSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+	srv := New(new(MockRepository), &config.Config{SnapshotPath: path})
+
+	before := cache.NewShardedCache(time.Hour, 4)
+	before.Set("abc123", "https://example.com")
+	srv.saveSnapshot(before)
+
+	// the next start comes back warm
+	after := cache.NewShardedCache(time.Hour, 4)
+	srv.loadSnapshot(after)
+	longURL, found := after.Get("abc123")
+	assert.True(t, found)
+	assert.Equal(t, "https://example.com", longURL)
+
+	// disabled without a path
+	srv = New(new(MockRepository), &config.Config{})
+	empty := cache.NewInMemoryCache(time.Hour)
+	srv.loadSnapshot(empty)
+	assert.Equal(t, 0, empty.Size())
+}
+
 func TestLoggingMiddleware(t *testing.T) {
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)